@@ -17,12 +17,17 @@ import (
 	"github.com/samlecuyer/ecumene/util"
 )
 
+var wrap = flag.Bool("wrap", false, "draw copies of the world for tiles past its edges")
+
 func main() {
 	flag.Parse()
 
 	input := flag.Arg(0)
 
-	m, _ := mapping.NewMap(input)
+	m, err := mapping.NewMap(input)
+	if err != nil {
+		log.Fatal(err)
+	}
 	r := rendering.NewRenderer(m, 256, 256)
 
 	mux := pat.New()
@@ -35,6 +40,9 @@ func main() {
 		x, _ := strconv.Atoi(x_str)
 		y, _ := strconv.Atoi(y_str)
 		z, _ := strconv.Atoi(z_str)
+		if *wrap {
+			x = util.WrapX(x, z)
+		}
 
 		lng0, lat0 := util.Num2deg(x, y, z)
 		lng0, lat0 = util.Gps2webmerc(lng0, lat0)
@@ -49,7 +57,7 @@ func main() {
 	}))
 
 	http.Handle("/", mux)
-	err := http.ListenAndServe(":3001", nil)
+	err = http.ListenAndServe(":3001", nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
@@ -10,6 +10,7 @@ import (
 
 	"flag"
 	"github.com/pkg/profile"
+	"log"
 	"os"
 )
 
@@ -21,7 +22,10 @@ func main() {
 	cwd, _ := os.Getwd()
 	defer profile.Start(profile.ProfilePath(cwd)).Stop()
 
-	m, _ := mapping.NewMap(input)
+	m, err := mapping.NewMap(input)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	r := rendering.NewRenderer(m, 5000, 5000)
 
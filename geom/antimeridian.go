@@ -0,0 +1,170 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+)
+
+// CutAntimeridian splits the lines and polygons of g where they cross
+// the antimeridian, so that none of their segments jumps from one side
+// of the map to the other.  A segment whose ends are more than π apart
+// in longitude is taken to go the short way round, across ±π.  Lines
+// that cross come back as a Multiline and polygons as a MultiPolygon;
+// anything that doesn't cross is returned as it is.  A polygon that
+// goes all the way round is closed over the pole on the side of the
+// equator where most of it is.  Coordinates are longitude and latitude
+// in radians.
+func CutAntimeridian(g Geometry) Geometry {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return CutAntimeridian(g.Geometry)
+	case Coordinates:
+		if crossesAntimeridian(g) {
+			return cutLine(g)
+		}
+	case Multiline:
+		if crossesAntimeridian(g...) {
+			var lines Multiline
+			for _, line := range g {
+				lines = append(lines, cutLine(line)...)
+			}
+			return lines
+		}
+	case Polygon:
+		if crossesAntimeridian(g...) {
+			return cutPolygon(g)
+		}
+	case MultiPolygon:
+		var rings []Coordinates
+		for _, polygon := range g {
+			rings = append(rings, polygon...)
+		}
+		if crossesAntimeridian(rings...) {
+			var polygons MultiPolygon
+			for _, polygon := range g {
+				polygons = append(polygons, cutPolygon(polygon)...)
+			}
+			return polygons
+		}
+	case GeometryCollection:
+		cut := make(GeometryCollection, len(g))
+		for i, member := range g {
+			cut[i] = CutAntimeridian(member)
+		}
+		return cut
+	}
+	return g
+}
+
+func crossesAntimeridian(lines ...Coordinates) bool {
+	for _, line := range lines {
+		for i := 1; i < len(line); i++ {
+			if math.Abs(line[i][0]-line[i-1][0]) > math.Pi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unwrap shifts the longitudes of the line by whole turns wherever it
+// crosses the antimeridian, so that it runs on without a jump.
+func unwrap(line Coordinates) Coordinates {
+	unwrapped := make(Coordinates, len(line))
+	shift := 0.0
+	for i, p := range line {
+		if i > 0 {
+			switch d := p[0] - line[i-1][0]; {
+			case d > math.Pi:
+				shift -= 2 * math.Pi
+			case d < -math.Pi:
+				shift += 2 * math.Pi
+			}
+		}
+		unwrapped[i] = Point{p[0] + shift, p[1]}
+	}
+	return unwrapped
+}
+
+func shiftLongitude(line Coordinates, dx float64) Coordinates {
+	shifted := make(Coordinates, len(line))
+	for i, p := range line {
+		shifted[i] = Point{p[0] + dx, p[1]}
+	}
+	return shifted
+}
+
+// eachTurn calls f with the box of every turn of the world that bb
+// reaches into, and the shift that brings that turn back to [-π, π].
+func eachTurn(bb Bbox, f func(turn Bbox, shift float64)) {
+	first := math.Floor((bb.MinX + math.Pi) / (2 * math.Pi))
+	last := math.Floor((bb.MaxX + math.Pi) / (2 * math.Pi))
+	for k := first; k <= last; k++ {
+		x := 2 * math.Pi * k
+		if x-math.Pi >= bb.MaxX || x+math.Pi <= bb.MinX {
+			continue
+		}
+		f(NewBbox(x-math.Pi, bb.MinY, x+math.Pi, bb.MaxY), -x)
+	}
+}
+
+func cutLine(line Coordinates) Multiline {
+	unwrapped := unwrap(line)
+	var lines Multiline
+	eachTurn(unwrapped.Bbox(), func(turn Bbox, shift float64) {
+		for _, piece := range ClipLine(unwrapped, turn) {
+			lines = append(lines, shiftLongitude(piece, shift))
+		}
+	})
+	return lines
+}
+
+func cutPolygon(polygon Polygon) MultiPolygon {
+	if len(polygon) == 0 {
+		return nil
+	}
+	unwrapped := make(Polygon, len(polygon))
+	for i, ring := range polygon {
+		ring = unwrap(ring)
+		if n := len(ring); n > 1 && ring[0][0] != ring[n-1][0] {
+			ring = closeOverPole(ring)
+		}
+		if i > 0 {
+			// keep the holes in the same turn as the exterior
+			d := unwrapped[0].Bbox().Center()[0] - ring.Bbox().Center()[0]
+			ring = shiftLongitude(ring, 2*math.Pi*math.Round(d/(2*math.Pi)))
+		}
+		unwrapped[i] = ring
+	}
+	var polygons MultiPolygon
+	eachTurn(unwrapped.Bbox(), func(turn Bbox, shift float64) {
+		clipped := ClipPolygon(unwrapped, turn)
+		if len(clipped) == 0 {
+			return
+		}
+		for i, ring := range clipped {
+			clipped[i] = shiftLongitude(ring, shift)
+		}
+		polygons = append(polygons, clipped)
+	})
+	return polygons
+}
+
+// closeOverPole closes a ring that goes all the way round the world by
+// running along the pole between its ends.
+func closeOverPole(ring Coordinates) Coordinates {
+	var lat float64
+	for _, p := range ring {
+		lat += p[1]
+	}
+	pole := math.Pi / 2
+	if lat < 0 {
+		pole = -pole
+	}
+	start, end := ring[0], ring[len(ring)-1]
+	closed := append(Coordinates(nil), ring...)
+	return append(closed, Point{end[0], pole}, Point{start[0], pole}, start)
+}
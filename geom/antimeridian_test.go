@@ -0,0 +1,87 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func degrees(g Geometry) Geometry {
+	r2d := func(line Coordinates) Coordinates {
+		out := make(Coordinates, len(line))
+		for i, p := range line {
+			out[i] = Point{math.Round(p[0]*180/math.Pi*1e9) / 1e9, math.Round(p[1]*180/math.Pi*1e9) / 1e9}
+		}
+		return out
+	}
+	switch g := g.(type) {
+	case Coordinates:
+		return r2d(g)
+	case Multiline:
+		out := make(Multiline, len(g))
+		for i, line := range g {
+			out[i] = r2d(line)
+		}
+		return out
+	case MultiPolygon:
+		out := make(MultiPolygon, len(g))
+		for i, polygon := range g {
+			for _, ring := range polygon {
+				out[i] = append(out[i], r2d(ring))
+			}
+		}
+		return out
+	}
+	return g
+}
+
+func radians(t *testing.T, s string) Geometry {
+	g := mustWKT(t, s)
+	d2r := func(line Coordinates) {
+		for i := range line {
+			line[i] = Point{line[i][0] * math.Pi / 180, line[i][1] * math.Pi / 180}
+		}
+	}
+	switch g := g.(type) {
+	case Coordinates:
+		d2r(g)
+	case Polygon:
+		for _, ring := range g {
+			d2r(ring)
+		}
+	}
+	return g
+}
+
+func TestCutAntimeridian(t *testing.T) {
+	cases := []struct {
+		wkt, expected string
+	}{
+		{"LINESTRING (170 0, -170 10)", "MULTILINESTRING ((170 0, 180 5), (-180 5, -170 10))"},
+		{"LINESTRING (-170 0, 170 10, -170 20)",
+			"MULTILINESTRING ((180 5, 170 10, 180 15), (-170 0, -180 5), (-180 15, -170 20))"},
+		// no crossing, so nothing changes
+		{"LINESTRING (-100 0, 70 10)", "LINESTRING (-100 0, 70 10)"},
+		{"POLYGON ((170 -10, -170 -10, -170 10, 170 10, 170 -10))",
+			"MULTIPOLYGON (((170 -10, 180 -10, 180 10, 170 10, 170 -10)), ((-180 -10, -170 -10, -170 10, -180 10, -180 -10)))"},
+	}
+	for _, c := range cases {
+		cut := CutAntimeridian(radians(t, c.wkt))
+		if s := wkt(t, degrees(cut)); s != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.wkt, c.expected, s)
+		}
+	}
+
+	// a band round the south pole comes out as a box down to it
+	band := radians(t, "POLYGON ((-180 -70, -90 -60, 0 -70, 90 -60, -180 -70))")
+	cut, ok := CutAntimeridian(band).(MultiPolygon)
+	if !ok || len(cut) != 1 {
+		t.Fatalf("expected one polygon round the pole, got %s", wkt(t, degrees(CutAntimeridian(band))))
+	}
+	if bb := cut.Bbox(); !near(bb.MinY, -math.Pi/2, 1e-12) || !near(bb.Width(), 2*math.Pi, 1e-12) {
+		t.Errorf("expected the polygon to reach the pole all the way round, got %s", wkt(t, degrees(cut)))
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"sort"
+)
+
+// JoinStyle is how offset lines and buffers go around corners.
+type JoinStyle int
+
+const (
+	// JoinRound goes around the corner in an arc.
+	JoinRound JoinStyle = iota
+	// JoinMitre carries both edges on until they meet in a point.
+	JoinMitre
+	// JoinBevel cuts straight across the corner.
+	JoinBevel
+)
+
+// MitreLimit is how far a mitre may reach from its corner, as a
+// multiple of the offset distance.  Sharper corners are bevelled.
+const MitreLimit = 4.0
+
+// arcSteps is how many straight pieces stand in for a quarter circle.
+const arcSteps = 8
+
+// normal is the unit vector to the left of the direction from a to b.
+func normal(a, b Point) (Point, bool) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return Point{}, false
+	}
+	return Point{-dy / length, dx / length}, true
+}
+
+func displace(p, n Point, d float64) Point {
+	return Point{p[0] + n[0]*d, p[1] + n[1]*d}
+}
+
+// join lists the points that go between p+n1*d and p+n2*d, not
+// counting either, to get around the outside of a corner at p.  With a
+// positive d the points are on the left of the line, so the corner is
+// one where it turns right; with a negative d it turns left.
+func join(p, n1, n2 Point, d float64, style JoinStyle) Coordinates {
+	switch style {
+	case JoinBevel:
+		return nil
+	case JoinMitre:
+		dot := n1[0]*n2[0] + n1[1]*n2[1]
+		if 1+dot > 0 && math.Sqrt(2/(1+dot)) <= MitreLimit {
+			scale := d / (1 + dot)
+			return Coordinates{{p[0] + (n1[0]+n2[0])*scale, p[1] + (n1[1]+n2[1])*scale}}
+		}
+		return nil
+	}
+	// going around the outside turns clockwise for a positive distance
+	// and anticlockwise for a negative one
+	from := math.Atan2(n1[1]*d, n1[0]*d)
+	sweep := math.Atan2(n2[1]*d, n2[0]*d) - from
+	if d > 0 {
+		for sweep >= 0 {
+			sweep -= 2 * math.Pi
+		}
+	} else {
+		for sweep <= 0 {
+			sweep += 2 * math.Pi
+		}
+	}
+	steps := int(math.Ceil(math.Abs(sweep) / (math.Pi / 2 / arcSteps)))
+	r := math.Abs(d)
+	var points Coordinates
+	for i := 1; i < steps; i++ {
+		angle := from + sweep*float64(i)/float64(steps)
+		points = append(points, Point{p[0] + r*math.Cos(angle), p[1] + r*math.Sin(angle)})
+	}
+	return points
+}
+
+// Offset is the line moved sideways by distance: to its left when the
+// distance is positive, and to its right when it is negative.  Corners
+// on the outside are joined with the given style, and those on the
+// inside are cut where the offset edges meet.  Where the line bends
+// back more tightly than the distance, the offset line loops.
+func Offset(line Coordinates, distance float64, style JoinStyle) Coordinates {
+	line = dedupe(line)
+	if len(line) < 2 || distance == 0 {
+		return append(Coordinates(nil), line...)
+	}
+	var offset Coordinates
+	var prev Point
+	var prevStart, prevEnd Point
+	for i := 0; i+1 < len(line); i++ {
+		a, b := line[i], line[i+1]
+		n, _ := normal(a, b)
+		start, end := displace(a, n, distance), displace(b, n, distance)
+		if i == 0 {
+			offset = append(offset, start)
+		} else {
+			turn := orient(line[i-1], a, b)
+			switch {
+			case turn == 0 && dot(line[i-1], a, b) >= 0:
+				// straight on, so the end of the last edge is the
+				// start of this one
+			case turn == 0 || (turn > 0) != (distance > 0):
+				corner := join(a, prev, n, distance, style)
+				if style == JoinMitre && len(corner) == 1 {
+					offset[len(offset)-1] = corner[0]
+				} else {
+					offset = append(offset, corner...)
+					offset = append(offset, start)
+				}
+			default:
+				if p, ok := lineIntersection(prevStart, prevEnd, start, end); ok {
+					offset[len(offset)-1] = p
+				} else {
+					offset = append(offset, start)
+				}
+			}
+		}
+		offset = append(offset, end)
+		prev, prevStart, prevEnd = n, start, end
+	}
+	return offset
+}
+
+// dot is the dot product of the directions a to b and b to c.
+func dot(a, b, c Point) float64 {
+	return (b[0]-a[0])*(c[0]-b[0]) + (b[1]-a[1])*(c[1]-b[1])
+}
+
+// lineIntersection is where the lines through ab and cd cross.
+func lineIntersection(a, b, c, d Point) (Point, bool) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	ex, ey := d[0]-c[0], d[1]-c[1]
+	denom := dx*ey - dy*ex
+	if denom == 0 {
+		return Point{}, false
+	}
+	t := ((c[0]-a[0])*ey - (c[1]-a[1])*ex) / denom
+	return interpolate(a, b, t), true
+}
+
+// Buffer is every point within distance of g.  Line ends are rounded,
+// and corners are joined with the given style.  A negative distance
+// shrinks polygons instead, and leaves nothing of points and lines.
+// Exteriors of the result wind anticlockwise and holes clockwise.
+func Buffer(g Geometry, distance float64, style JoinStyle) MultiPolygon {
+	if distance == 0 {
+		return append(MultiPolygon(nil), polygonsOf(g)...)
+	}
+	var rings []Coordinates
+	addBuffer(&rings, g, distance, style)
+	return assemble(windingBoundary(rings), func(ring Coordinates) bool {
+		return !ring.IsClockwise()
+	})
+}
+
+// addBuffer adds rings that together wind positively around the buffer
+// of g: the polygons themselves, wound positively, and the bands of
+// width distance around every line and ring, which add to the polygons
+// when distance is positive and take away from them when it is
+// negative.
+func addBuffer(rings *[]Coordinates, g Geometry, distance float64, style JoinStyle) {
+	add := func(pieces []Coordinates) {
+		for _, piece := range pieces {
+			if (signedArea(piece) > 0) != (distance > 0) {
+				piece = reversed(piece)
+			}
+			*rings = append(*rings, piece)
+		}
+	}
+	switch g := g.(type) {
+	case ZMGeometry:
+		addBuffer(rings, g.Geometry, distance, style)
+	case Point:
+		if distance > 0 && !isEmpty(g) {
+			add([]Coordinates{circle(g, distance)})
+		}
+	case MultiPoint:
+		for _, p := range g {
+			addBuffer(rings, p, distance, style)
+		}
+	case Coordinates:
+		if distance > 0 {
+			add(band(g, distance, style, false))
+		}
+	case Multiline:
+		for _, line := range g {
+			addBuffer(rings, line, distance, style)
+		}
+	case Polygon:
+		for i, ring := range g {
+			ring = dedupe(ring)
+			if len(ring) < 4 {
+				continue
+			}
+			if ring.IsClockwise() == (i == 0) {
+				ring = reversed(ring)
+			}
+			*rings = append(*rings, ring)
+			add(band(ring, math.Abs(distance), style, true))
+		}
+	case MultiPolygon:
+		for _, polygon := range g {
+			addBuffer(rings, polygon, distance, style)
+		}
+	case GeometryCollection:
+		for _, member := range g {
+			addBuffer(rings, member, distance, style)
+		}
+	}
+}
+
+// band lists convex pieces that together cover every point within d of
+// the line: a rectangle along each edge, a wedge on the outside of each
+// corner, and a half circle on each end of an open line.
+func band(line Coordinates, d float64, style JoinStyle, closed bool) []Coordinates {
+	line = dedupe(line)
+	if closed && len(line) > 1 && line[0] == line[len(line)-1] {
+		line = line[:len(line)-1]
+	}
+	if len(line) == 0 {
+		return nil
+	}
+	if len(line) == 1 || (closed && len(line) < 3) {
+		return []Coordinates{circle(line[0], d)}
+	}
+	edges := len(line) - 1
+	if closed {
+		edges = len(line)
+	}
+	normals := make([]Point, edges)
+	var pieces []Coordinates
+	for i := 0; i < edges; i++ {
+		a, b := line[i], line[(i+1)%len(line)]
+		n, _ := normal(a, b)
+		normals[i] = n
+		pieces = append(pieces, Coordinates{
+			displace(a, n, d), displace(a, n, -d), displace(b, n, -d), displace(b, n, d), displace(a, n, d),
+		})
+	}
+	corner := func(prev, p, next Point, n1, n2 Point) {
+		turn := orient(prev, p, next)
+		if turn == 0 && dot(prev, p, next) >= 0 {
+			return
+		}
+		side := d
+		if turn > 0 {
+			side = -d
+		}
+		piece := Coordinates{p, displace(p, n1, side)}
+		piece = append(piece, join(p, n1, n2, side, style)...)
+		piece = append(piece, displace(p, n2, side), p)
+		if signedArea(piece) != 0 {
+			pieces = append(pieces, piece)
+		}
+	}
+	for i := 1; i < edges; i++ {
+		corner(line[i-1], line[i], line[(i+1)%len(line)], normals[i-1], normals[i])
+	}
+	if closed {
+		corner(line[len(line)-1], line[0], line[1], normals[edges-1], normals[0])
+		return pieces
+	}
+	first, last := normals[0], normals[edges-1]
+	end := line[len(line)-1]
+	endCap := Coordinates{end, displace(end, last, d)}
+	endCap = append(endCap, join(end, last, Point{-last[0], -last[1]}, d, JoinRound)...)
+	endCap = append(endCap, displace(end, last, -d), end)
+	start := line[0]
+	startCap := Coordinates{start, displace(start, first, -d)}
+	startCap = append(startCap, join(start, Point{-first[0], -first[1]}, first, d, JoinRound)...)
+	startCap = append(startCap, displace(start, first, d), start)
+	return append(pieces, endCap, startCap)
+}
+
+// circle is a closed ring around c with radius r.
+func circle(c Point, r float64) Coordinates {
+	steps := 4 * arcSteps
+	ring := make(Coordinates, steps+1)
+	for i := 0; i < steps; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(steps)
+		ring[i] = Point{c[0] + r*math.Cos(angle), c[1] + r*math.Sin(angle)}
+	}
+	ring[steps] = ring[0]
+	return ring
+}
+
+func reversed(ring Coordinates) Coordinates {
+	r := make(Coordinates, len(ring))
+	for i, p := range ring {
+		r[len(ring)-1-i] = p
+	}
+	return r
+}
+
+type windingEdge struct {
+	a, b   Point
+	splits []Point
+}
+
+// windingBoundary traces the outline of the area where the rings wind
+// positively.  The edges of the rings are cut wherever they meet, and
+// the pieces with a positive winding number on their left and none on
+// their right are linked up into rings, with the area on their left.
+func windingBoundary(rings []Coordinates) []Coordinates {
+	snap := snapper(rings)
+	snapped := make([]Coordinates, 0, len(rings))
+	for _, ring := range rings {
+		s := make(Coordinates, len(ring))
+		for i, p := range ring {
+			s[i] = snap(p)
+		}
+		if s = dedupe(s); len(s) >= 4 {
+			snapped = append(snapped, s)
+		}
+	}
+	rings = snapped
+
+	var edges []*windingEdge
+	boxes := make([]Bbox, len(rings))
+	for r, ring := range rings {
+		boxes[r] = ring.Bbox()
+		for i := 0; i+1 < len(ring); i++ {
+			edges = append(edges, &windingEdge{a: ring[i], b: ring[i+1]})
+		}
+	}
+	nodeEdges(edges, snap)
+
+	winding := func(p Point) int {
+		w := 0
+		for r, ring := range rings {
+			if boxes[r].ContainsPoint(p) {
+				w += windingNumber(p, ring)
+			}
+		}
+		return w
+	}
+	type key [2]Point
+	seen := make(map[key]bool)
+	outgoing := make(map[Point][]int)
+	var kept [][2]Point
+	for _, e := range edges {
+		points := append([]Point{e.a}, e.splits...)
+		points = append(points, e.b)
+		for i := 0; i+1 < len(points); i++ {
+			a, b := points[i], points[i+1]
+			if a == b || seen[key{a, b}] {
+				continue
+			}
+			seen[key{a, b}] = true
+			n, _ := normal(a, b)
+			m := interpolate(a, b, 0.5)
+			eps := math.Hypot(b[0]-a[0], b[1]-a[1]) * 1e-4
+			if winding(displace(m, n, eps)) > 0 && winding(displace(m, n, -eps)) <= 0 {
+				outgoing[a] = append(outgoing[a], len(kept))
+				kept = append(kept, [2]Point{a, b})
+			}
+		}
+	}
+
+	used := make([]bool, len(kept))
+	var boundary []Coordinates
+	for i := range kept {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		ring := Coordinates{kept[i][0], kept[i][1]}
+		for ring[len(ring)-1] != ring[0] {
+			from, at := ring[len(ring)-2], ring[len(ring)-1]
+			next, best := -1, math.Inf(-1)
+			for _, j := range outgoing[at] {
+				if used[j] {
+					continue
+				}
+				// take the sharpest left turn, so that the ring
+				// follows the area closely
+				if turn := turnAngle(from, at, kept[j][1]); turn > best {
+					next, best = j, turn
+				}
+			}
+			if next < 0 {
+				break
+			}
+			used[next] = true
+			ring = append(ring, kept[next][1])
+		}
+		if ring[len(ring)-1] != ring[0] {
+			continue
+		}
+		for _, r := range splitRing(ring) {
+			if len(r) >= 4 && signedArea(r) != 0 {
+				boundary = append(boundary, r)
+			}
+		}
+	}
+	return boundary
+}
+
+// splitRing cuts a closed ring wherever it comes back to a point it has
+// already been through, so that a hole that touches the exterior at a
+// point comes out as a ring of its own.
+func splitRing(ring Coordinates) []Coordinates {
+	var rings []Coordinates
+	var stack Coordinates
+	seen := make(map[Point]int)
+	for _, p := range ring[:len(ring)-1] {
+		if i, ok := seen[p]; ok {
+			loop := append(Coordinates(nil), stack[i:]...)
+			rings = append(rings, append(loop, p))
+			for _, q := range stack[i+1:] {
+				delete(seen, q)
+			}
+			stack = stack[:i+1]
+			continue
+		}
+		seen[p] = len(stack)
+		stack = append(stack, p)
+	}
+	return append(rings, append(stack, stack[0]))
+}
+
+// snapBits is how much finer than the size of the rings the grid their
+// points are snapped to is, in bits.
+const snapBits = 36
+
+// snapper rounds points to a fine grid, so that points that ought to be
+// the same but were worked out differently, such as a corner of one
+// piece of a buffer lying on the arc of another, come out equal.
+func snapper(rings []Coordinates) func(Point) Point {
+	scale := 0.0
+	for _, ring := range rings {
+		for _, p := range ring {
+			scale = math.Max(scale, math.Max(math.Abs(p[0]), math.Abs(p[1])))
+		}
+	}
+	if scale == 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return func(p Point) Point { return p }
+	}
+	_, exp := math.Frexp(scale)
+	grid := math.Ldexp(1, exp-snapBits)
+	return func(p Point) Point {
+		return Point{math.Round(p[0]/grid) * grid, math.Round(p[1]/grid) * grid}
+	}
+}
+
+// turnAngle is how far the direction from b to c turns left of the
+// direction from a to b.
+func turnAngle(a, b, c Point) float64 {
+	in := math.Atan2(b[1]-a[1], b[0]-a[0])
+	out := math.Atan2(c[1]-b[1], c[0]-b[0])
+	turn := out - in
+	for turn <= -math.Pi {
+		turn += 2 * math.Pi
+	}
+	for turn > math.Pi {
+		turn -= 2 * math.Pi
+	}
+	return turn
+}
+
+// nodeEdges finds everywhere the edges meet, and records on each edge the
+// points where it has to be cut, in order along it.  Crossings are
+// snapped like the points of the rings.  The edges are
+// swept from left to right, so only those that overlap in x are
+// compared.
+func nodeEdges(edges []*windingEdge, snap func(Point) Point) {
+	minX := func(e *windingEdge) float64 { return math.Min(e.a[0], e.b[0]) }
+	maxX := func(e *windingEdge) float64 { return math.Max(e.a[0], e.b[0]) }
+	sorted := append([]*windingEdge(nil), edges...)
+	sort.Slice(sorted, func(i, j int) bool { return minX(sorted[i]) < minX(sorted[j]) })
+
+	var active []*windingEdge
+	for _, e := range sorted {
+		kept := active[:0]
+		for _, other := range active {
+			if maxX(other) >= minX(e) {
+				kept = append(kept, other)
+			}
+		}
+		active = kept
+		for _, other := range active {
+			if math.Max(e.a[1], e.b[1]) >= math.Min(other.a[1], other.b[1]) &&
+				math.Max(other.a[1], other.b[1]) >= math.Min(e.a[1], e.b[1]) {
+				cutEdges(e, other, snap)
+			}
+		}
+		active = append(active, e)
+	}
+	for _, e := range edges {
+		dx, dy := e.b[0]-e.a[0], e.b[1]-e.a[1]
+		along := func(p Point) float64 { return (p[0]-e.a[0])*dx + (p[1]-e.a[1])*dy }
+		sort.Slice(e.splits, func(i, j int) bool { return along(e.splits[i]) < along(e.splits[j]) })
+	}
+}
+
+// cutEdges records where two edges meet on each of them.
+func cutEdges(e, f *windingEdge, snap func(Point) Point) {
+	a, b, c, d := e.a, e.b, f.a, f.b
+	o1, o2 := orient(c, d, a), orient(c, d, b)
+	o3, o4 := orient(a, b, c), orient(a, b, d)
+	if o1*o2 < 0 && o3*o4 < 0 {
+		if p, ok := lineIntersection(a, b, c, d); ok {
+			p = snap(p)
+			e.splits = append(e.splits, p)
+			f.splits = append(f.splits, p)
+		}
+		return
+	}
+	within := func(p, from, to Point) bool {
+		return p != from && p != to && onSegment(from, to, p)
+	}
+	if o3 == 0 && within(c, a, b) {
+		e.splits = append(e.splits, c)
+	}
+	if o4 == 0 && within(d, a, b) {
+		e.splits = append(e.splits, d)
+	}
+	if o1 == 0 && within(a, c, d) {
+		f.splits = append(f.splits, a)
+	}
+	if o2 == 0 && within(b, c, d) {
+		f.splits = append(f.splits, b)
+	}
+}
+
+// windingNumber is how many times the ring goes anticlockwise around p.
+func windingNumber(p Point, ring Coordinates) int {
+	winding := 0
+	for i := 0; i+1 < len(ring); i++ {
+		a, b := ring[i], ring[i+1]
+		if a[1] <= p[1] {
+			if b[1] > p[1] && orient(a, b, p) > 0 {
+				winding++
+			}
+		} else if b[1] <= p[1] && orient(a, b, p) < 0 {
+			winding--
+		}
+	}
+	return winding
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOffset(t *testing.T) {
+	l := Coordinates{{0, 0}, {10, 0}, {10, 10}}
+	cases := []struct {
+		line     Coordinates
+		distance float64
+		style    JoinStyle
+		expected string
+	}{
+		{Coordinates{{0, 0}, {10, 0}}, 1, JoinRound, "LINESTRING (0 1, 10 1)"},
+		{Coordinates{{0, 0}, {10, 0}}, -1, JoinRound, "LINESTRING (0 -1, 10 -1)"},
+		{Coordinates{{0, 0}, {5, 0}, {5, 0}, {10, 0}}, 1, JoinMitre, "LINESTRING (0 1, 5 1, 10 1)"},
+		// the inside of the corner is cut short
+		{l, 1, JoinMitre, "LINESTRING (0 1, 9 1, 9 10)"},
+		{l, 1, JoinRound, "LINESTRING (0 1, 9 1, 9 10)"},
+		// and the outside is joined
+		{l, -1, JoinMitre, "LINESTRING (0 -1, 11 -1, 11 10)"},
+		{l, -1, JoinBevel, "LINESTRING (0 -1, 10 -1, 11 0, 11 10)"},
+		{Coordinates{{0, 0}}, 1, JoinRound, "LINESTRING (0 0)"},
+	}
+	for _, c := range cases {
+		if offset := wkt(t, Offset(c.line, c.distance, c.style)); offset != c.expected {
+			t.Errorf("offsetting %s by %v: expected %s, got %s", wkt(t, c.line), c.distance, c.expected, offset)
+		}
+	}
+
+	round := Offset(l, -1, JoinRound)
+	if len(round) != 4+arcSteps-1 {
+		t.Errorf("expected a quarter circle of %d pieces, got %s", arcSteps, wkt(t, round))
+	}
+	for _, p := range round[1 : len(round)-1] {
+		if d := math.Hypot(p[0]-10, p[1]); !near(d, 1, 1e-9) {
+			t.Errorf("expected %v to be on the arc around the corner, but it is %v away", p, d)
+		}
+	}
+
+	// a sharp corner is bevelled rather than mitred
+	sharp := Coordinates{{0, 0}, {10, 0}, {0, 1}}
+	if offset := Offset(sharp, -1, JoinMitre); len(offset) != 4 {
+		t.Errorf("expected a sharp corner to be bevelled, got %s", wkt(t, offset))
+	}
+}
+
+// checkBuffer checks that the buffer is made of valid polygons whose
+// rings don't cross, and that its area is about right.
+func checkBuffer(t *testing.T, name string, buffer MultiPolygon, polygons, holes int, area float64) {
+	checkBufferWithin(t, name, buffer, polygons, holes, area, 1e-3)
+}
+
+func checkBufferWithin(t *testing.T, name string, buffer MultiPolygon, polygons, holes int, area, tolerance float64) {
+	if len(buffer) != polygons {
+		t.Errorf("%s: expected %d polygons, got %d", name, polygons, len(buffer))
+	}
+	n := 0
+	for _, polygon := range buffer {
+		n += len(polygon.Interiors())
+		if polygon.Exterior().IsClockwise() {
+			t.Errorf("%s: expected the exterior to wind anticlockwise", name)
+		}
+		for _, hole := range polygon.Interiors() {
+			if !hole.IsClockwise() {
+				t.Errorf("%s: expected the holes to wind clockwise", name)
+			}
+		}
+		if ringsCross(polygon) {
+			t.Errorf("%s: the rings of %s cross", name, wkt(t, polygon))
+		}
+	}
+	if n != holes {
+		t.Errorf("%s: expected %d holes, got %d", name, holes, n)
+	}
+	if a := Area(buffer); !near(a, area, area*tolerance) {
+		t.Errorf("%s: expected an area of %v, got %v", name, area, a)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	// the area of the circles used, which have 4*arcSteps sides
+	circle := 2 * arcSteps * math.Sin(math.Pi/(2*arcSteps))
+
+	square := mustWKT(t, "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0))")
+	cw := mustWKT(t, "POLYGON ((0 0, 0 10, 10 10, 10 0, 0 0))")
+	holed := mustWKT(t, "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 4 6, 6 6, 6 4, 4 4))")
+	line := mustWKT(t, "LINESTRING (0 0, 10 0)")
+	// a line that runs back across its start, enclosing a square
+	u := mustWKT(t, "LINESTRING (0 0, 10 0, 10 10, 0 10, 0 -5)")
+	crossing := mustWKT(t, "LINESTRING (0 0, 10 10, 10 0, 0 10)")
+	points := mustWKT(t, "MULTIPOINT ((0 0), (10 0), (1 0))")
+
+	checkBuffer(t, "point", Buffer(Point{5, 5}, 2, JoinRound), 1, 0, 4*circle)
+	// two of the circles overlap in a lens
+	lens := 2 * (math.Acos(0.5) - 0.5*math.Sqrt(0.75))
+	checkBufferWithin(t, "points", Buffer(points, 1, JoinRound), 2, 0, 3*circle-lens, 1e-2)
+	checkBuffer(t, "line", Buffer(line, 1, JoinRound), 1, 0, 20+circle)
+	checkBuffer(t, "square mitred", Buffer(square, 1, JoinMitre), 1, 0, 144)
+	checkBuffer(t, "clockwise square", Buffer(cw, 1, JoinMitre), 1, 0, 144)
+	checkBuffer(t, "square bevelled", Buffer(square, 1, JoinBevel), 1, 0, 142)
+	checkBuffer(t, "square rounded", Buffer(square, 1, JoinRound), 1, 0, 140+circle)
+	checkBuffer(t, "square shrunk", Buffer(square, -1, JoinRound), 1, 0, 64)
+	checkBuffer(t, "square gone", Buffer(square, -6, JoinRound), 0, 0, 0)
+	checkBuffer(t, "hole shrunk", Buffer(holed, 0.5, JoinMitre), 1, 1, 121-1)
+	checkBuffer(t, "hole filled", Buffer(holed, 1.5, JoinMitre), 1, 0, 169)
+	checkBuffer(t, "hole grown", Buffer(holed, -1, JoinMitre), 1, 1, 64-16)
+	checkBuffer(t, "u", Buffer(u, 1, JoinMitre), 1, 1, 144-64+8+circle/2)
+	checkBuffer(t, "zero", Buffer(square, 0, JoinRound), 1, 0, 100)
+	checkBuffer(t, "line shrunk", Buffer(line, -1, JoinRound), 0, 0, 0)
+
+	// a line that crosses itself still comes out as simple rings
+	b := Buffer(crossing, 0.5, JoinRound)
+	checkBuffer(t, "crossing", b, 1, 1, Area(b))
+	for _, p := range []Point{{0, 0}, {5, 5}, {10, 5}, {0, 10}} {
+		if Locate(p, b) != Interior {
+			t.Errorf("expected %v to be inside the buffer", p)
+		}
+	}
+	for _, p := range []Point{{2, 5}, {8, 5}, {-1, 5}} {
+		if Locate(p, b) != Exterior {
+			t.Errorf("expected %v to be outside the buffer", p)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+)
+
+// Clip cuts g down to the parts that fall inside bb.  Lines become a
+// Multiline, since a single line may leave and re-enter the box, and
+// geometries that are entirely outside come back empty.
+func Clip(g Geometry, bb Bbox) Geometry {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return Clip(g.Geometry, bb)
+	case Point:
+		if bb.ContainsPoint(g) {
+			return g
+		}
+		return Point{math.NaN(), math.NaN()}
+	case MultiPoint:
+		var points MultiPoint
+		for _, p := range g {
+			if bb.ContainsPoint(p) {
+				points = append(points, p)
+			}
+		}
+		return points
+	case Coordinates:
+		return ClipLine(g, bb)
+	case Multiline:
+		var lines Multiline
+		for _, line := range g {
+			lines = append(lines, ClipLine(line, bb)...)
+		}
+		return lines
+	case Polygon:
+		return ClipPolygon(g, bb)
+	case MultiPolygon:
+		var polygons MultiPolygon
+		for _, polygon := range g {
+			if clipped := ClipPolygon(polygon, bb); clipped != nil {
+				polygons = append(polygons, clipped)
+			}
+		}
+		return polygons
+	case GeometryCollection:
+		var gc GeometryCollection
+		for _, member := range g {
+			gc = append(gc, Clip(member, bb))
+		}
+		return gc
+	}
+	return g
+}
+
+// interpolate returns the point a fraction t of the way from a to b.
+func interpolate(a, b Point, t float64) Point {
+	return Point{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+}
+
+// ClipLine cuts a line into the pieces that fall inside bb.  Pieces
+// that only touch the box at a single point are dropped.
+func ClipLine(line Coordinates, bb Bbox) Multiline {
+	var lines Multiline
+	var current Coordinates
+	flush := func() {
+		for _, p := range current[1:] {
+			if p != current[0] {
+				lines = append(lines, current)
+				break
+			}
+		}
+		current = nil
+	}
+	for i := 0; i+1 < len(line); i++ {
+		a, b, ok := clipSegment(line[i], line[i+1], bb)
+		if !ok {
+			if current != nil {
+				flush()
+			}
+			continue
+		}
+		if current == nil {
+			current = Coordinates{a}
+		}
+		current = append(current, b)
+		if b != line[i+1] {
+			flush()
+		}
+	}
+	if current != nil {
+		flush()
+	}
+	return lines
+}
+
+// clipSegment is Liang-Barsky clipping of the segment from a to b.
+func clipSegment(a, b Point, bb Bbox) (Point, Point, bool) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{
+		{-dx, a[0] - bb.MinX},
+		{dx, bb.MaxX - a[0]},
+		{-dy, a[1] - bb.MinY},
+		{dy, bb.MaxY - a[1]},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return a, b, false
+			}
+			if r > t0 {
+				t0 = r
+			}
+		} else {
+			if r < t0 {
+				return a, b, false
+			}
+			if r < t1 {
+				t1 = r
+			}
+		}
+	}
+	ca, cb := a, b
+	if t0 > 0 {
+		ca = interpolate(a, b, t0)
+	}
+	if t1 < 1 {
+		cb = interpolate(a, b, t1)
+	}
+	return ca, cb, true
+}
+
+// ClipPolygon cuts a polygon down to bb, keeping its holes.  The result
+// is nil if the exterior falls entirely outside the box.  Where a ring
+// crosses the box, the clipped ring runs along the edge of the box, so
+// it may touch itself there, but it still fills correctly.
+func ClipPolygon(polygon Polygon, bb Bbox) Polygon {
+	var clipped Polygon
+	for i, ring := range polygon {
+		ring = clipRing(ring, bb)
+		if ring == nil {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		clipped = append(clipped, ring)
+	}
+	return clipped
+}
+
+// clipRing is Sutherland-Hodgman clipping of a ring against each edge
+// of the box in turn.  The returned ring is closed, or nil if nothing
+// is left of it.
+func clipRing(ring Coordinates, bb Bbox) Coordinates {
+	if len(ring) < 3 {
+		return nil
+	}
+	rb := ring.Bbox()
+	if bb.Contains(rb) {
+		return ring
+	}
+	if !bb.Intersects(rb) {
+		return nil
+	}
+
+	out := ring
+	if out[0] == out[len(out)-1] {
+		out = out[:len(out)-1]
+	}
+	for edge := 0; edge < 4 && len(out) > 0; edge++ {
+		in := out
+		out = make(Coordinates, 0, len(in)+4)
+		prev := in[len(in)-1]
+		for _, cur := range in {
+			curIn, prevIn := insideEdge(cur, bb, edge), insideEdge(prev, bb, edge)
+			if curIn != prevIn {
+				out = append(out, crossEdge(prev, cur, bb, edge))
+			}
+			if curIn {
+				out = append(out, cur)
+			}
+			prev = cur
+		}
+	}
+
+	// drop the repeated points that vertices on the edges leave behind
+	var clipped Coordinates
+	for _, p := range out {
+		if len(clipped) == 0 || clipped[len(clipped)-1] != p {
+			clipped = append(clipped, p)
+		}
+	}
+	if len(clipped) > 1 && clipped[0] == clipped[len(clipped)-1] {
+		clipped = clipped[:len(clipped)-1]
+	}
+	if len(clipped) < 3 {
+		return nil
+	}
+	return append(clipped, clipped[0])
+}
+
+func insideEdge(p Point, bb Bbox, edge int) bool {
+	switch edge {
+	case 0:
+		return p[0] >= bb.MinX
+	case 1:
+		return p[0] <= bb.MaxX
+	case 2:
+		return p[1] >= bb.MinY
+	default:
+		return p[1] <= bb.MaxY
+	}
+}
+
+func crossEdge(a, b Point, bb Bbox, edge int) Point {
+	var t float64
+	switch edge {
+	case 0:
+		t = (bb.MinX - a[0]) / (b[0] - a[0])
+	case 1:
+		t = (bb.MaxX - a[0]) / (b[0] - a[0])
+	case 2:
+		t = (bb.MinY - a[1]) / (b[1] - a[1])
+	default:
+		t = (bb.MaxY - a[1]) / (b[1] - a[1])
+	}
+	p := interpolate(a, b, t)
+	// pin the crossing exactly onto the edge, whatever the rounding
+	switch edge {
+	case 0:
+		p[0] = bb.MinX
+	case 1:
+		p[0] = bb.MaxX
+	case 2:
+		p[1] = bb.MinY
+	default:
+		p[1] = bb.MaxY
+	}
+	return p
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"testing"
+)
+
+// window is the box from (0, 0) to (10, 10).
+var window = Bbox{0, 0, 10, 10}
+
+func wkt(t *testing.T, g Geometry) string {
+	s, err := MarshalWKT(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestClipLine(t *testing.T) {
+	cases := map[string]string{
+		"LINESTRING (1 1, 2 2)":                   "MULTILINESTRING ((1 1, 2 2))",
+		"LINESTRING (-5 5, 15 5)":                 "MULTILINESTRING ((0 5, 10 5))",
+		"LINESTRING (-5 5, 5 5, 5 15, 8 15, 8 5)": "MULTILINESTRING ((0 5, 5 5, 5 10), (8 10, 8 5))",
+		"LINESTRING (-5 -5, -5 15)":               "MULTILINESTRING EMPTY",
+		"LINESTRING (-5 5, 5 -5)":                 "MULTILINESTRING EMPTY",
+		"LINESTRING (0 0, 10 0)":                  "MULTILINESTRING ((0 0, 10 0))",
+		// the values are dropped
+		"LINESTRING Z (-5 5 1, 15 5 2)": "MULTILINESTRING ((0 5, 10 5))",
+	}
+	for in, expected := range cases {
+		line, _ := UnmarshalWKT(in)
+		if out := wkt(t, Clip(line, window)); out != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, out)
+		}
+	}
+}
+
+func TestClipPolygon(t *testing.T) {
+	cases := map[string]string{
+		// entirely inside
+		"POLYGON ((1 1, 1 2, 2 2, 1 1))": "POLYGON ((1 1, 1 2, 2 2, 1 1))",
+		// entirely outside
+		"POLYGON ((20 20, 20 30, 30 30, 20 20))": "POLYGON EMPTY",
+		// covers the whole window
+		"POLYGON ((-5 -5, -5 15, 15 15, 15 -5, -5 -5))": "POLYGON ((10 10, 10 0, 0 0, 0 10, 10 10))",
+		// crosses the right edge, with one hole kept and one dropped
+		"POLYGON ((5 2, 5 8, 15 8, 15 2, 5 2), (6 3, 7 3, 7 4, 6 3), (12 3, 13 3, 13 4, 12 3))": "POLYGON ((10 2, 5 2, 5 8, 10 8, 10 2), (6 3, 7 3, 7 4, 6 3))",
+		// a hole that crosses the edge is cut as well
+		"POLYGON ((-5 -5, -5 15, 15 15, 15 -5, -5 -5), (8 4, 12 4, 12 6, 8 6, 8 4))": "POLYGON ((10 10, 10 0, 0 0, 0 10, 10 10), (8 4, 10 4, 10 6, 8 6, 8 4))",
+	}
+	for in, expected := range cases {
+		polygon, _ := UnmarshalWKT(in)
+		if out := wkt(t, Clip(polygon, window)); out != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, out)
+		}
+	}
+}
+
+func TestClipPoint(t *testing.T) {
+	if out := wkt(t, Clip(Point{5, 5}, window)); out != "POINT (5 5)" {
+		t.Errorf("expected the point, got %s", out)
+	}
+	if out := wkt(t, Clip(Point{15, 5}, window)); out != "POINT EMPTY" {
+		t.Errorf("expected an empty point, got %s", out)
+	}
+	mp := MultiPoint{{5, 5}, {15, 5}}
+	if out := wkt(t, Clip(mp, window)); out != "MULTIPOINT ((5 5))" {
+		t.Errorf("expected one point, got %s", out)
+	}
+	for in, expected := range map[string]string{"POINT Z (5 5 1)": "POINT (5 5)", "POINT M (15 5 1)": "POINT EMPTY"} {
+		if out := wkt(t, Clip(mustWKT(t, in), window)); out != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, out)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+)
+
+// Triangulation is a set of triangles whose corners are points.
+type Triangulation struct {
+	// Points are the distinct points that were triangulated, sorted
+	// by x and then y.
+	Points MultiPoint
+	// Triangles index Points, and wind anticlockwise.
+	Triangles [][3]int
+}
+
+// Polygons lists the triangles as polygons.
+func (t *Triangulation) Polygons() MultiPolygon {
+	polygons := make(MultiPolygon, len(t.Triangles))
+	for i, tri := range t.Triangles {
+		a, b, c := t.Points[tri[0]], t.Points[tri[1]], t.Points[tri[2]]
+		polygons[i] = Polygon{{a, b, c, a}}
+	}
+	return polygons
+}
+
+type delaunayTriangle struct {
+	v [3]int
+	// the centre of the circle through the corners, and its radius
+	// squared
+	cx, cy, r2 float64
+}
+
+// Delaunay triangulates the points so that no point is inside the
+// circle through the corners of any triangle.  It is the Bowyer-Watson
+// algorithm, with the points added from left to right so that
+// triangles whose circles are behind the sweep can be set aside.
+// Repeated and non-finite points are left out, and points that are all
+// in a line have no triangles.
+func Delaunay(points MultiPoint) *Triangulation {
+	pts := distinctPoints(points)
+	t := &Triangulation{Points: pts}
+	if len(pts) < 3 {
+		return t
+	}
+
+	// a triangle around everything to start from, whose corners come
+	// after the points
+	n := len(pts)
+	bb := pts.Bbox()
+	size := math.Max(math.Max(bb.Width(), bb.Height()), 1e-9)
+	c := bb.Center()
+	all := append(pts[:n:n],
+		Point{c[0] - 1e4*size, c[1] - 1e4*size},
+		Point{c[0] + 1e4*size, c[1] - 1e4*size},
+		Point{c[0], c[1] + 1e4*size},
+	)
+	triangle := func(a, b, c int) delaunayTriangle {
+		if orient(all[a], all[b], all[c]) < 0 {
+			b, c = c, b
+		}
+		pa, pb, pc := all[a], all[b], all[c]
+		bx, by := pb[0]-pa[0], pb[1]-pa[1]
+		cx, cy := pc[0]-pa[0], pc[1]-pa[1]
+		d := 2 * (bx*cy - by*cx)
+		b2, c2 := bx*bx+by*by, cx*cx+cy*cy
+		ux, uy := (cy*b2-by*c2)/d, (bx*c2-cx*b2)/d
+		return delaunayTriangle{[3]int{a, b, c}, pa[0] + ux, pa[1] + uy, ux*ux + uy*uy}
+	}
+
+	open := []delaunayTriangle{triangle(n, n+1, n+2)}
+	var done []delaunayTriangle
+	for i, p := range pts {
+		var edges [][2]int
+		kept := open[:0]
+		for _, tri := range open {
+			dx := p[0] - tri.cx
+			if dx > 0 && dx*dx > tri.r2 {
+				// every point from here on is further right, so
+				// none of them can be inside this circle
+				done = append(done, tri)
+				continue
+			}
+			if inCircle(all[tri.v[0]], all[tri.v[1]], all[tri.v[2]], p) {
+				for k := 0; k < 3; k++ {
+					edges = append(edges, [2]int{tri.v[k], tri.v[(k+1)%3]})
+				}
+				continue
+			}
+			kept = append(kept, tri)
+		}
+		open = kept
+		// the edges that only one of the removed triangles had are
+		// the outline of the hole they leave, to be joined to p
+		shared := make(map[[2]int]bool)
+		for _, e := range edges {
+			shared[[2]int{e[1], e[0]}] = true
+		}
+		for _, e := range edges {
+			if !shared[e] {
+				open = append(open, triangle(e[0], e[1], i))
+			}
+		}
+	}
+
+	for _, tri := range append(done, open...) {
+		if tri.v[0] < n && tri.v[1] < n && tri.v[2] < n {
+			t.Triangles = append(t.Triangles, tri.v)
+		}
+	}
+	return t
+}
+
+// inCircle reports whether d is inside the circle through a, b and c,
+// which wind anticlockwise.
+func inCircle(a, b, c, d Point) bool {
+	ax, ay := a[0]-d[0], a[1]-d[1]
+	bx, by := b[0]-d[0], b[1]-d[1]
+	cx, cy := c[0]-d[0], c[1]-d[1]
+	det := (ax*ax+ay*ay)*(bx*cy-cx*by) -
+		(bx*bx+by*by)*(ax*cy-cx*ay) +
+		(cx*cx+cy*cy)*(ax*by-bx*ay)
+	return det > 0
+}
+
+// Voronoi divides bounds into a cell for each point, holding the part
+// of bounds that is closer to that point than to any other.  The cells
+// are in the same order as the points; repeated points share a cell,
+// and non-finite points have none.
+func Voronoi(points MultiPoint, bounds Bbox) MultiPolygon {
+	cells := make(MultiPolygon, len(points))
+	if bounds.IsEmpty() {
+		return cells
+	}
+	t := Delaunay(points)
+	// only neighbours in the triangulation share an edge, unless
+	// there are no triangles
+	neighbours := make([]map[int]bool, len(t.Points))
+	for i := range neighbours {
+		neighbours[i] = make(map[int]bool)
+	}
+	for _, tri := range t.Triangles {
+		for k := 0; k < 3; k++ {
+			a, b := tri[k], tri[(k+1)%3]
+			neighbours[a][b], neighbours[b][a] = true, true
+		}
+	}
+	if len(t.Triangles) == 0 {
+		for i := range t.Points {
+			for j := range t.Points {
+				if i != j {
+					neighbours[i][j] = true
+				}
+			}
+		}
+	}
+
+	index := make(map[Point]int, len(t.Points))
+	for i, p := range t.Points {
+		index[p] = i
+	}
+	made := make([]Polygon, len(t.Points))
+	for i, p := range points {
+		j, ok := index[p]
+		if !ok {
+			continue
+		}
+		if made[j] == nil {
+			cell := bounds.Polygon().Exterior()
+			for k := range neighbours[j] {
+				cell = closerTo(cell, t.Points[j], t.Points[k])
+			}
+			if len(cell) >= 4 {
+				made[j] = Polygon{cell}
+			}
+		}
+		cells[i] = made[j]
+	}
+	return cells
+}
+
+// closerTo cuts a convex ring down to the part that is closer to p
+// than to q.
+func closerTo(ring Coordinates, p, q Point) Coordinates {
+	mx, my := (p[0]+q[0])/2, (p[1]+q[1])/2
+	dx, dy := q[0]-p[0], q[1]-p[1]
+	side := func(a Point) float64 {
+		return (a[0]-mx)*dx + (a[1]-my)*dy
+	}
+	var cut Coordinates
+	for i := 0; i+1 < len(ring); i++ {
+		a, b := ring[i], ring[i+1]
+		sa, sb := side(a), side(b)
+		if sa <= 0 {
+			cut = append(cut, a)
+		}
+		if (sa < 0 && sb > 0) || (sa > 0 && sb < 0) {
+			cut = append(cut, interpolate(a, b, sa/(sa-sb)))
+		}
+	}
+	if len(cut) < 3 {
+		return nil
+	}
+	return append(cut, cut[0])
+}
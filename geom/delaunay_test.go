@@ -0,0 +1,99 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func randomPoints(r *rand.Rand, n int) MultiPoint {
+	points := make(MultiPoint, n)
+	for i := range points {
+		points[i] = Point{r.Float64() * 100, r.Float64() * 100}
+	}
+	return points
+}
+
+func TestDelaunay(t *testing.T) {
+	points := randomPoints(rand.New(rand.NewSource(1)), 200)
+	tr := Delaunay(points)
+	// every triangulation of n points with h of them on the hull has
+	// 2n - 2 - h triangles
+	hull := len(ConvexHull(points).Exterior()) - 1
+	if expected := 2*len(points) - 2 - hull; len(tr.Triangles) != expected {
+		t.Errorf("expected %d triangles, got %d", expected, len(tr.Triangles))
+	}
+	for _, tri := range tr.Triangles {
+		a, b, c := tr.Points[tri[0]], tr.Points[tri[1]], tr.Points[tri[2]]
+		if orient(a, b, c) <= 0 {
+			t.Fatalf("triangle %v winds the wrong way", tri)
+		}
+		for _, p := range tr.Points {
+			if inCircle(a, b, c, p) {
+				t.Fatalf("%v is inside the circle of triangle %v", p, tri)
+			}
+		}
+	}
+	if !near(Area(tr.Polygons()), Area(ConvexHull(points)), 1e-9) {
+		t.Error("expected the triangles to cover the convex hull")
+	}
+
+	// a grid has four points on every circle, and points in a line
+	// all along its edges
+	var grid MultiPoint
+	for x := 0.0; x < 5; x++ {
+		for y := 0.0; y < 5; y++ {
+			grid = append(grid, Point{x, y})
+		}
+	}
+	if tr := Delaunay(grid); len(tr.Triangles) != 2*25-2-16 || Area(tr.Polygons()) != 16 {
+		t.Errorf("expected the grid to be split into 32 triangles, got %s", wkt(t, tr.Polygons()))
+	}
+
+	if tr := Delaunay(MultiPoint{{0, 0}, {1, 1}, {2, 2}, {1, 1}}); len(tr.Points) != 3 || len(tr.Triangles) != 0 {
+		t.Errorf("expected 3 points in a line and no triangles, got %v", tr)
+	}
+}
+
+func TestVoronoi(t *testing.T) {
+	bounds := NewBbox(0, 0, 100, 100)
+	points := randomPoints(rand.New(rand.NewSource(2)), 100)
+	points = append(points, points[0])
+	cells := Voronoi(points, bounds)
+	if len(cells) != len(points) {
+		t.Fatalf("expected %d cells, got %d", len(points), len(cells))
+	}
+	total := 0.0
+	for i, cell := range cells[:len(cells)-1] {
+		total += Area(cell)
+		if locatePolygon(points[i], cell) != Interior {
+			t.Errorf("%v is not in its own cell %s", points[i], wkt(t, cell))
+		}
+		// the middle of the cell is closest to its point
+		c := Centroid(cell)
+		for j, p := range points {
+			if distance(c, p) < distance(c, points[i]) && p != points[i] {
+				t.Errorf("the centre of cell %d is closer to %v", i, j)
+				break
+			}
+		}
+	}
+	if !near(total, 100*100, 1e-6) {
+		t.Errorf("expected the cells to cover the bounds, got an area of %v", total)
+	}
+	if wkt(t, cells[len(cells)-1]) != wkt(t, cells[0]) {
+		t.Error("expected a repeated point to share its cell")
+	}
+
+	two := Voronoi(MultiPoint{{25, 50}, {75, 50}}, bounds)
+	if Area(two[0]) != 5000 || Area(two[1]) != 5000 {
+		t.Errorf("expected two points to split the bounds in half, got %s", wkt(t, two))
+	}
+}
+
+func distance(a, b Point) float64 {
+	return (a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1])
+}
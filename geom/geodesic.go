@@ -0,0 +1,69 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+)
+
+// GreatCircleDistance is the distance from a to b along a great circle
+// of a sphere of EarthRadius, in metres.  Coordinates are longitude and
+// latitude in radians.
+func GreatCircleDistance(a, b Point) float64 {
+	return haversine(a, b) * EarthRadius
+}
+
+// GreatCircleInterpolate is the point a fraction f of the way from a to
+// b along the great circle between them.  Coordinates are longitude and
+// latitude in radians.
+func GreatCircleInterpolate(a, b Point, f float64) Point {
+	angle := haversine(a, b)
+	if angle == 0 {
+		return a
+	}
+	sa, sb := math.Sin((1-f)*angle)/math.Sin(angle), math.Sin(f*angle)/math.Sin(angle)
+	ax, ay, az := unitVector(a)
+	bx, by, bz := unitVector(b)
+	x, y, z := sa*ax+sb*bx, sa*ay+sb*by, sa*az+sb*bz
+	return Point{math.Atan2(y, x), math.Atan2(z, math.Hypot(x, y))}
+}
+
+func unitVector(p Point) (float64, float64, float64) {
+	cosLat := math.Cos(p[1])
+	return cosLat * math.Cos(p[0]), cosLat * math.Sin(p[0]), math.Sin(p[1])
+}
+
+// Densify adds points to every segment of the line longer than
+// maxLength, evenly along it, so that no piece is longer.
+func Densify(line Coordinates, maxLength float64) Coordinates {
+	return densify(line, maxLength, func(a, b Point) float64 {
+		return math.Hypot(b[0]-a[0], b[1]-a[1])
+	}, interpolate)
+}
+
+// DensifyGreatCircle adds points to every segment of the line longer
+// than maxDistance metres, along the great circle between its ends, so
+// that the line follows great circles once it is projected.
+// Coordinates are longitude and latitude in radians.
+func DensifyGreatCircle(line Coordinates, maxDistance float64) Coordinates {
+	return densify(line, maxDistance, GreatCircleDistance, GreatCircleInterpolate)
+}
+
+func densify(line Coordinates, max float64, length func(a, b Point) float64, along func(a, b Point, f float64) Point) Coordinates {
+	if max <= 0 || len(line) < 2 {
+		return line
+	}
+	dense := Coordinates{line[0]}
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		if pieces := math.Ceil(length(a, b) / max); pieces > 1 && !math.IsInf(pieces, 0) {
+			for k := 1.0; k < pieces; k++ {
+				dense = append(dense, along(a, b, k/pieces))
+			}
+		}
+		dense = append(dense, b)
+	}
+	return dense
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGreatCircle(t *testing.T) {
+	d2r := math.Pi / 180
+	london := Point{-0.1278 * d2r, 51.5074 * d2r}
+	newYork := Point{-74.006 * d2r, 40.7128 * d2r}
+	if d := GreatCircleDistance(london, newYork); !near(d, 5576e3, 5e3) {
+		t.Errorf("expected London to be about 5576 km from New York, got %v", d)
+	}
+
+	a, b := Point{0, 45 * d2r}, Point{90 * d2r, 45 * d2r}
+	mid := GreatCircleInterpolate(a, b, 0.5)
+	// the great circle bows out towards the pole
+	if !near(mid[0], 45*d2r, 1e-12) || mid[1] <= 45*d2r {
+		t.Errorf("expected the middle to be north of 45°, got %v", Point{mid[0] / d2r, mid[1] / d2r})
+	}
+	if end := GreatCircleInterpolate(a, b, 1); !near(end[0], b[0], 1e-12) || !near(end[1], b[1], 1e-12) {
+		t.Errorf("expected the end to be %v, got %v", b, end)
+	}
+}
+
+func TestDensify(t *testing.T) {
+	line := Coordinates{{0, 0}, {10, 0}, {10, 1}}
+	if dense := Densify(line, 2.5); wkt(t, dense) != "LINESTRING (0 0, 2.5 0, 5 0, 7.5 0, 10 0, 10 1)" {
+		t.Errorf("unexpected densified line %s", wkt(t, dense))
+	}
+	if dense := Densify(line, 0); len(dense) != len(line) {
+		t.Errorf("expected no limit to leave the line alone, got %s", wkt(t, dense))
+	}
+
+	d2r := math.Pi / 180
+	path := Coordinates{{0, 45 * d2r}, {90 * d2r, 45 * d2r}}
+	dense := DensifyGreatCircle(path, 100e3)
+	for i := 1; i < len(dense); i++ {
+		if d := GreatCircleDistance(dense[i-1], dense[i]); d > 100e3 {
+			t.Fatalf("piece %d is %v m long", i, d)
+		}
+	}
+	if !near(GeodesicLength(dense), GreatCircleDistance(path[0], path[1]), 1) {
+		t.Error("expected the densified line to follow the great circle")
+	}
+}
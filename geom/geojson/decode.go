@@ -0,0 +1,256 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"strconv"
+)
+
+// Feature is a decoded GeoJSON feature.  It is a geom.Shape whose
+// attributes are its properties.
+type Feature struct {
+	ID         interface{}
+	Geometry   geom.Geometry
+	Properties map[string]interface{}
+}
+
+func (f *Feature) Bbox() geom.Bbox {
+	if f.Geometry == nil {
+		return geom.EmptyBbox()
+	}
+	return f.Geometry.Bbox()
+}
+
+// Attribute formats a property as a string.  Missing and null
+// properties are empty.
+func (f *Feature) Attribute(name string) string {
+	switch v := f.Properties[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func (f *Feature) Attributes() map[string]string {
+	attrs := make(map[string]string, len(f.Properties))
+	for name := range f.Properties {
+		attrs[name] = f.Attribute(name)
+	}
+	return attrs
+}
+
+type object struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometries  []json.RawMessage `json:"geometries"`
+
+	ID         interface{}            `json:"id"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+
+	Features []json.RawMessage `json:"features"`
+}
+
+// Unmarshal reads a GeoJSON geometry object.  Positions with a third
+// number have a Z, and those with a fourth an M as well, and are read
+// as a geom.ZMGeometry.
+func Unmarshal(data []byte) (geom.Geometry, error) {
+	var zm geom.ZMReader
+	g, err := unmarshal(data, &zm)
+	if err != nil {
+		return nil, err
+	}
+	return zm.Wrap(g), nil
+}
+
+func unmarshal(data []byte, zm *geom.ZMReader) (geom.Geometry, error) {
+	var obj object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj.geometry(zm)
+}
+
+func UnmarshalFeature(data []byte) (*Feature, error) {
+	var obj object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj.feature()
+}
+
+func UnmarshalFeatureCollection(data []byte) ([]*Feature, error) {
+	var obj object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if obj.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("geojson: expected a FeatureCollection, got %q", obj.Type)
+	}
+	features := make([]*Feature, len(obj.Features))
+	for i, raw := range obj.Features {
+		var member object
+		if err := json.Unmarshal(raw, &member); err != nil {
+			return nil, err
+		}
+		f, err := member.feature()
+		if err != nil {
+			return nil, fmt.Errorf("geojson: feature %d: %v", i, err)
+		}
+		features[i] = f
+	}
+	return features, nil
+}
+
+func (obj *object) feature() (*Feature, error) {
+	if obj.Type != "Feature" {
+		return nil, fmt.Errorf("geojson: expected a Feature, got %q", obj.Type)
+	}
+	f := &Feature{ID: obj.ID, Properties: obj.Properties}
+	if len(obj.Geometry) > 0 && string(obj.Geometry) != "null" {
+		g, err := Unmarshal(obj.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		f.Geometry = g
+	}
+	return f, nil
+}
+
+func (obj *object) geometry(zm *geom.ZMReader) (geom.Geometry, error) {
+	var err error
+	switch obj.Type {
+	case "Point":
+		var pos []float64
+		if err = obj.coordinates(&pos); err == nil {
+			defer zm.EndPart()
+			if len(pos) == 0 {
+				zm.Vertex(math.NaN(), math.NaN())
+				return geom.Point{math.NaN(), math.NaN()}, nil
+			}
+			return position(pos, zm)
+		}
+	case "LineString":
+		var pos [][]float64
+		if err = obj.coordinates(&pos); err == nil {
+			return positions(pos, zm)
+		}
+	case "MultiPoint":
+		var pos [][]float64
+		if err = obj.coordinates(&pos); err == nil {
+			var points geom.MultiPoint
+			for _, p := range pos {
+				point, err := position(p, zm)
+				if err != nil {
+					return nil, err
+				}
+				zm.EndPart()
+				points = append(points, point)
+			}
+			return points, nil
+		}
+	case "Polygon":
+		var pos [][][]float64
+		if err = obj.coordinates(&pos); err == nil {
+			rings, err := rings(pos, zm)
+			return geom.Polygon(rings), err
+		}
+	case "MultiLineString":
+		var pos [][][]float64
+		if err = obj.coordinates(&pos); err == nil {
+			rings, err := rings(pos, zm)
+			return geom.Multiline(rings), err
+		}
+	case "MultiPolygon":
+		var pos [][][][]float64
+		if err = obj.coordinates(&pos); err == nil {
+			var polygons geom.MultiPolygon
+			for _, polygon := range pos {
+				rings, err := rings(polygon, zm)
+				if err != nil {
+					return nil, err
+				}
+				polygons = append(polygons, geom.Polygon(rings))
+			}
+			return polygons, nil
+		}
+	case "GeometryCollection":
+		var gc geom.GeometryCollection
+		for _, raw := range obj.Geometries {
+			g, err := unmarshal(raw, zm)
+			if err != nil {
+				return nil, err
+			}
+			gc = append(gc, g)
+		}
+		return gc, nil
+	default:
+		return nil, fmt.Errorf("geojson: unknown geometry type %q", obj.Type)
+	}
+	return nil, fmt.Errorf("geojson: bad %s coordinates: %v", obj.Type, err)
+}
+
+func (obj *object) coordinates(v interface{}) error {
+	if len(obj.Coordinates) == 0 {
+		return fmt.Errorf("missing coordinates")
+	}
+	return json.Unmarshal(obj.Coordinates, v)
+}
+
+func position(pos []float64, zm *geom.ZMReader) (geom.Point, error) {
+	if len(pos) < 2 {
+		return geom.Point{}, fmt.Errorf("geojson: a position needs at least 2 numbers, got %d", len(pos))
+	}
+	z, m := math.NaN(), math.NaN()
+	if len(pos) > 2 {
+		z, zm.HasZ = pos[2], true
+	}
+	if len(pos) > 3 {
+		m, zm.HasM = pos[3], true
+	}
+	zm.Vertex(z, m)
+	return geom.Point{pos[0], pos[1]}, nil
+}
+
+func positions(pos [][]float64, zm *geom.ZMReader) (geom.Coordinates, error) {
+	defer zm.EndPart()
+	if len(pos) == 0 {
+		return nil, nil
+	}
+	coords := make(geom.Coordinates, len(pos))
+	for i, p := range pos {
+		var err error
+		if coords[i], err = position(p, zm); err != nil {
+			return nil, err
+		}
+	}
+	return coords, nil
+}
+
+func rings(pos [][][]float64, zm *geom.ZMReader) ([]geom.Coordinates, error) {
+	if len(pos) == 0 {
+		return nil, nil
+	}
+	rings := make([]geom.Coordinates, len(pos))
+	for i, ring := range pos {
+		var err error
+		if rings[i], err = positions(ring, zm); err != nil {
+			return nil, err
+		}
+	}
+	return rings, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package geojson reads and writes geom geometries and shapes as GeoJSON.
+package geojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrBadCoordinate = errors.New("Coordinate is not a finite number")
+
+// Encoder writes GeoJSON.
+type Encoder struct {
+	// Precision is the number of decimals kept for each coordinate.
+	// The zero value keeps as many as are needed to read the same
+	// value back.
+	Precision int
+	// Fields lists the attributes written as feature properties.  If
+	// it is empty, every attribute of a geom.AttributedShape is
+	// written.
+	Fields []string
+}
+
+// Marshal writes g as a GeoJSON geometry at full precision.  The
+// positions of a geom.ZMGeometry have its Z, and its M after that;
+// GeoJSON has no way to give an M without a Z, so M alone is dropped.
+func Marshal(g geom.Geometry) ([]byte, error) {
+	return Encoder{}.Geometry(g)
+}
+
+func (e Encoder) Geometry(g geom.Geometry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.writeGeometry(&buf, g, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Feature writes shape as a GeoJSON feature.
+func (e Encoder) Feature(shape geom.Shape) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.writeFeature(&buf, shape); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e Encoder) FeatureCollection(shapes []geom.Shape) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i, shape := range shapes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := e.writeFeature(&buf, shape); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes(), nil
+}
+
+func (e Encoder) writeFeature(buf *bytes.Buffer, shape geom.Shape) error {
+	buf.WriteString(`{"type":"Feature",`)
+	if f, ok := shape.(*Feature); ok && f.ID != nil {
+		id, err := json.Marshal(f.ID)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`"id":`)
+		buf.Write(id)
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"geometry":`)
+	if g := Geometry(shape); g != nil {
+		if err := e.writeGeometry(buf, g, nil); err != nil {
+			return err
+		}
+	} else {
+		buf.WriteString("null")
+	}
+
+	if f, ok := shape.(*Feature); ok && len(e.Fields) == 0 {
+		props, err := json.Marshal(f.Properties)
+		if err != nil {
+			return err
+		}
+		if f.Properties == nil {
+			props = []byte("{}")
+		}
+		buf.WriteString(`,"properties":`)
+		buf.Write(props)
+		buf.WriteByte('}')
+		return nil
+	}
+
+	props := make(map[string]string)
+	if len(e.Fields) > 0 {
+		for _, field := range e.Fields {
+			props[field] = shape.Attribute(field)
+		}
+	} else if attributed, ok := shape.(geom.AttributedShape); ok {
+		props = attributed.Attributes()
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteString(`,"properties":{`)
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(name)
+		v, _ := json.Marshal(props[name])
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteString(`}}`)
+	return nil
+}
+
+// Geometry returns the geometry of a shape, or nil if the shape is not
+// one of the geom shape types.
+func Geometry(shape geom.Shape) geom.Geometry {
+	if f, ok := shape.(*Feature); ok {
+		return f.Geometry
+	}
+	return geom.GeometryOf(shape)
+}
+
+func (e Encoder) writeGeometry(buf *bytes.Buffer, g geom.Geometry, zm *geom.ZMCursor) error {
+	var err error
+	switch g := g.(type) {
+	case geom.ZMGeometry:
+		return e.writeGeometry(buf, g.Geometry, geom.NewZMCursor(g.Values))
+	case geom.Point:
+		buf.WriteString(`{"type":"Point","coordinates":`)
+		if math.IsNaN(g[0]) && math.IsNaN(g[1]) {
+			zm.Next()
+			buf.WriteString("[]")
+		} else {
+			err = e.writePosition(buf, g, zm)
+		}
+	case geom.Coordinates:
+		buf.WriteString(`{"type":"LineString","coordinates":`)
+		err = e.writePositions(buf, g, zm)
+	case geom.Polygon:
+		buf.WriteString(`{"type":"Polygon","coordinates":`)
+		err = e.writeRings(buf, g, zm)
+	case geom.MultiPoint:
+		buf.WriteString(`{"type":"MultiPoint","coordinates":`)
+		err = e.writePositions(buf, geom.Coordinates(g), zm)
+	case geom.Multiline:
+		buf.WriteString(`{"type":"MultiLineString","coordinates":`)
+		err = e.writeRings(buf, g, zm)
+	case geom.MultiPolygon:
+		buf.WriteString(`{"type":"MultiPolygon","coordinates":[`)
+		for i, polygon := range g {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err = e.writeRings(buf, polygon, zm); err != nil {
+				break
+			}
+		}
+		buf.WriteByte(']')
+	case geom.GeometryCollection:
+		buf.WriteString(`{"type":"GeometryCollection","geometries":[`)
+		for i, member := range g {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err = e.writeGeometry(buf, member, zm); err != nil {
+				break
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return geom.ErrUnsupportedGeometry
+	}
+	buf.WriteByte('}')
+	return err
+}
+
+func (e Encoder) writeRings(buf *bytes.Buffer, rings []geom.Coordinates, zm *geom.ZMCursor) error {
+	buf.WriteByte('[')
+	for i, ring := range rings {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := e.writePositions(buf, ring, zm); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func (e Encoder) writePositions(buf *bytes.Buffer, coords geom.Coordinates, zm *geom.ZMCursor) error {
+	buf.WriteByte('[')
+	for i, p := range coords {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := e.writePosition(buf, p, zm); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func (e Encoder) writePosition(buf *bytes.Buffer, p geom.Point, zm *geom.ZMCursor) error {
+	ords := []float64{p[0], p[1]}
+	z, m := zm.Next()
+	if hasZ, hasM := zm.Has(); hasZ {
+		ords = append(ords, z)
+		if hasM {
+			ords = append(ords, m)
+		}
+	}
+	buf.WriteByte('[')
+	for i, v := range ords {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrBadCoordinate
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(e.formatFloat(v))
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func (e Encoder) formatFloat(v float64) string {
+	if e.Precision <= 0 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(v, 'f', e.Precision, 64)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
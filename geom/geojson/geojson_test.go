@@ -0,0 +1,176 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geojson
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"testing"
+)
+
+var fixtures = []string{
+	`{"type":"Point","coordinates":[1,2]}`,
+	`{"type":"Point","coordinates":[]}`,
+	`{"type":"LineString","coordinates":[[0,0],[1.5,-1]]}`,
+	`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]],[[1,1],[2,1],[2,2],[1,1]]]}`,
+	`{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`,
+	`{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}`,
+	`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`,
+	`{"type":"MultiPolygon","coordinates":[]}`,
+	`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[]}]}`,
+	`{"type":"GeometryCollection","geometries":[]}`,
+	`{"type":"Point","coordinates":[1,2,3]}`,
+	`{"type":"LineString","coordinates":[[0,0,1,7],[1.5,-1,2,8]]}`,
+	`{"type":"Polygon","coordinates":[[[0,0,5],[10,0,5],[10,10,6],[0,0,5]]]}`,
+	`{"type":"MultiPoint","coordinates":[[1,2,3,4],[3,4,5,6]]}`,
+	`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2,3]},{"type":"LineString","coordinates":[[0,0,1],[1,1,2]]}]}`,
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, fixture := range fixtures {
+		g, err := Unmarshal([]byte(fixture))
+		if err != nil {
+			t.Errorf("%s: %v", fixture, err)
+			continue
+		}
+		out, err := Marshal(g)
+		if err != nil {
+			t.Errorf("%s: %v", fixture, err)
+		} else if string(out) != fixture {
+			t.Errorf("expected %s, got %s", fixture, out)
+		}
+	}
+	// GeoJSON has no M without a Z
+	for in, expected := range map[string]string{
+		"POINT Z (1 2 3)":                  `{"type":"Point","coordinates":[1,2,3]}`,
+		"POINT M (1 2 3)":                  `{"type":"Point","coordinates":[1,2]}`,
+		"LINESTRING ZM (1 2 3 4, 5 6 7 8)": `{"type":"LineString","coordinates":[[1,2,3,4],[5,6,7,8]]}`,
+	} {
+		g, _ := geom.UnmarshalWKT(in)
+		if out, err := Marshal(g); err != nil || string(out) != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", in, expected, out, err)
+		}
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	g := geom.Coordinates{{-118.944862413904, 34.823301}, {0.00000001, -0.0000001}}
+	expected := `{"type":"LineString","coordinates":[[-118.945,34.823],[0,0]]}`
+	out, _ := Encoder{Precision: 3}.Geometry(g)
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+	expected = `{"type":"LineString","coordinates":[[-118.944862413904,34.823301],[0.00000001,-0.0000001]]}`
+	out, _ = Marshal(g)
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+}
+
+type testShape struct {
+	p     geom.Point
+	attrs map[string]string
+}
+
+func (s *testShape) Bbox() geom.Bbox   { return s.p.Bbox() }
+func (s *testShape) Point() geom.Point { return s.p }
+
+func (s *testShape) Attribute(name string) string  { return s.attrs[name] }
+func (s *testShape) Attributes() map[string]string { return s.attrs }
+
+func TestFeatureCollection(t *testing.T) {
+	shapes := []geom.Shape{
+		&testShape{geom.Point{1, 2}, map[string]string{"name": `"Quoted"`, "pop": "100"}},
+		&testShape{geom.Point{3, 4}, nil},
+	}
+	expected := `{"type":"FeatureCollection","features":[` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"\"Quoted\"","pop":"100"}},` +
+		`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{}}]}`
+	out, err := Encoder{}.FeatureCollection(shapes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+
+	out, _ = Encoder{Fields: []string{"pop"}}.Feature(shapes[0])
+	expected = `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"pop":"100"}}`
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestFeature(t *testing.T) {
+	in := `{"type":"Feature","id":7,"geometry":{"type":"Point","coordinates":[1,2,3]},"properties":{"a":"x","b":1.5,"c":true,"d":null}}`
+	f, err := UnmarshalFeature([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"a": "x", "b": "1.5", "c": "true", "d": "", "e": ""} {
+		if got := f.Attribute(name); got != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, got)
+		}
+	}
+	out, _ := Encoder{}.Feature(f)
+	expected := `{"type":"Feature","id":7,"geometry":{"type":"Point","coordinates":[1,2,3]},"properties":{"a":"x","b":1.5,"c":true,"d":null}}`
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+
+	f, err = UnmarshalFeature([]byte(`{"type":"Feature","geometry":null,"properties":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Geometry != nil {
+		t.Error("expected a feature without geometry")
+	}
+	out, _ = Encoder{}.Feature(f)
+	if expected = `{"type":"Feature","geometry":null,"properties":{}}`; string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestUnmarshalFeatureCollection(t *testing.T) {
+	in := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"a"}},
+		{"type":"Feature","geometry":{"type":"LineString","coordinates":[[1,2],[3,4]]},"properties":{"name":"b"}}
+	]}`
+	features, err := UnmarshalFeatureCollection([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 || features[1].Attribute("name") != "b" {
+		t.Errorf("unexpected features %v", features)
+	}
+	if _, ok := features[1].Geometry.(geom.Coordinates); !ok {
+		t.Errorf("expected a LineString, got %T", features[1].Geometry)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	bad := []string{
+		`{"type":"Circle","coordinates":[1,2]}`,
+		`{"type":"Point","coordinates":[1]}`,
+		`{"type":"Point"}`,
+		`{"type":"LineString","coordinates":[1,2]}`,
+		`{"type":"Polygon","coordinates":[[[0,0],[1]]]}`,
+		`[1,2]`,
+	}
+	for _, in := range bad {
+		if _, err := Unmarshal([]byte(in)); err == nil {
+			t.Errorf("%s should not decode", in)
+		}
+	}
+	if _, err := UnmarshalFeature([]byte(fixtures[0])); err == nil {
+		t.Error("a geometry is not a feature")
+	}
+	if _, err := UnmarshalFeatureCollection([]byte(`{"type":"Feature"}`)); err == nil {
+		t.Error("a feature is not a feature collection")
+	}
+	if _, err := Marshal(geom.Coordinates{{1, 0}, {0, math.Inf(1)}}); err != ErrBadCoordinate {
+		t.Errorf("expected ErrBadCoordinate, got %v", err)
+	}
+}
@@ -5,54 +5,199 @@
 package geom
 
 import (
+	"errors"
 	"math"
 )
 
+var ErrUnsupportedGeometry = errors.New("Unsupported Geometry")
+
 type Geometry interface {
 	Bbox() Bbox
 }
 
-type Bbox [4]float64
+// Bbox is an axis-aligned box.  A box whose minimum is past its maximum
+// on either axis is empty; it contains nothing, and is what the Bbox of
+// an empty geometry is.
+type Bbox struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// NewBbox is the box with (x0, y0) and (x1, y1) as opposite corners, in
+// any order.
+func NewBbox(x0, y0, x1, y1 float64) Bbox {
+	return Bbox{
+		math.Min(x0, x1), math.Min(y0, y1),
+		math.Max(x0, x1), math.Max(y0, y1),
+	}
+}
+
+// EmptyBbox is a box that contains nothing, and is the identity for
+// Union.
+func EmptyBbox() Bbox {
+	return Bbox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+// IsEmpty reports whether the box contains no points at all.  A box
+// with NaN bounds is empty.
+func (bb Bbox) IsEmpty() bool {
+	return !(bb.MinX <= bb.MaxX && bb.MinY <= bb.MaxY)
+}
+
+func (bb Bbox) Width() float64 {
+	if bb.IsEmpty() {
+		return 0
+	}
+	return bb.MaxX - bb.MinX
+}
+
+func (bb Bbox) Height() float64 {
+	if bb.IsEmpty() {
+		return 0
+	}
+	return bb.MaxY - bb.MinY
+}
+
+func (bb Bbox) Center() Point {
+	return Point{(bb.MinX + bb.MaxX) / 2, (bb.MinY + bb.MaxY) / 2}
+}
+
+// Union is the smallest box that holds both boxes.
+func (bb Bbox) Union(other Bbox) Bbox {
+	if bb.IsEmpty() {
+		return other
+	}
+	if other.IsEmpty() {
+		return bb
+	}
+	return Bbox{
+		math.Min(bb.MinX, other.MinX), math.Min(bb.MinY, other.MinY),
+		math.Max(bb.MaxX, other.MaxX), math.Max(bb.MaxY, other.MaxY),
+	}
+}
 
-func (bb Bbox) ExpandToFit(other Bbox) Bbox {
+// Intersection is the box the two boxes have in common, which is empty
+// if they don't meet.
+func (bb Bbox) Intersection(other Bbox) Bbox {
+	if !bb.Intersects(other) {
+		return EmptyBbox()
+	}
 	return Bbox{
-		math.Min(bb[0], other[0]),
-		math.Max(bb[1], other[1]),
-		math.Max(bb[2], other[2]),
-		math.Min(bb[3], other[3]),
+		math.Max(bb.MinX, other.MinX), math.Max(bb.MinY, other.MinY),
+		math.Min(bb.MaxX, other.MaxX), math.Min(bb.MaxY, other.MaxY),
+	}
+}
+
+// Intersects reports whether the boxes share any point, including
+// along their edges.
+func (bb Bbox) Intersects(other Bbox) bool {
+	return !bb.IsEmpty() && !other.IsEmpty() &&
+		bb.MinX <= other.MaxX && other.MinX <= bb.MaxX &&
+		bb.MinY <= other.MaxY && other.MinY <= bb.MaxY
+}
+
+// Overlaps reports whether the insides of the boxes meet, so boxes that
+// only share an edge don't overlap.
+func (bb Bbox) Overlaps(other Bbox) bool {
+	return bb.MinX < other.MaxX && other.MinX < bb.MaxX &&
+		bb.MinY < other.MaxY && other.MinY < bb.MaxY
+}
+
+// Contains reports whether other is entirely inside the box, edges
+// included.  Nothing contains an empty box.
+func (bb Bbox) Contains(other Bbox) bool {
+	return !bb.IsEmpty() && !other.IsEmpty() &&
+		bb.MinX <= other.MinX && other.MaxX <= bb.MaxX &&
+		bb.MinY <= other.MinY && other.MaxY <= bb.MaxY
+}
+
+// ContainsPoint reports whether p is inside the box or on its edge.
+func (bb Bbox) ContainsPoint(p Point) bool {
+	return p[0] >= bb.MinX && p[0] <= bb.MaxX && p[1] >= bb.MinY && p[1] <= bb.MaxY
+}
+
+// Buffer grows the box by d on every side, or shrinks it if d is
+// negative.  An empty box stays empty.
+func (bb Bbox) Buffer(d float64) Bbox {
+	if bb.IsEmpty() {
+		return bb
 	}
+	return Bbox{bb.MinX - d, bb.MinY - d, bb.MaxX + d, bb.MaxY + d}
 }
 
-func (r Bbox) Overlaps(s Bbox) bool {
-	// r.Min.X < s.Max.X && s.Min.X < r.Max.X &&
-	// r.Min.Y < s.Max.Y && s.Min.Y < r.Max.Y
-	return r[0] < s[2] && s[0] < r[2] &&
-		r[3] < s[1] && s[3] < r[1]
+// Polygon is the box as a polygon with a single ring.
+func (bb Bbox) Polygon() Polygon {
+	return Polygon{{
+		{bb.MinX, bb.MinY}, {bb.MaxX, bb.MinY}, {bb.MaxX, bb.MaxY}, {bb.MinX, bb.MaxY}, {bb.MinX, bb.MinY},
+	}}
 }
 
 type Point [2]float64
 
-func (p *Point) Bbox() Bbox {
+func (p Point) Bbox() Bbox {
 	return Bbox{p[0], p[1], p[0], p[1]}
 }
 
 type Coordinates []Point
 type Multiline []Coordinates
 
+// Polygon is a single polygon.  The first ring is the exterior, and any
+// rings after it are holes.
+type Polygon []Coordinates
+
+type MultiPoint []Point
+type MultiPolygon []Polygon
+type GeometryCollection []Geometry
+
 func (points Multiline) Bbox() Bbox {
-	p := points[0]
-	bb := p.Bbox()
-	for i := 1; i < len(points); i++ {
-		bb = bb.ExpandToFit(points[i].Bbox())
+	bb := EmptyBbox()
+	for _, line := range points {
+		bb = bb.Union(line.Bbox())
 	}
 	return bb
 }
 
 func (points Coordinates) Bbox() Bbox {
-	p := points[0]
-	bb := p.Bbox()
-	for i := 1; i < len(points); i++ {
-		bb = bb.ExpandToFit(points[i].Bbox())
+	bb := EmptyBbox()
+	for _, p := range points {
+		bb = bb.Union(p.Bbox())
+	}
+	return bb
+}
+
+func (p Polygon) Exterior() Coordinates {
+	if len(p) == 0 {
+		return nil
+	}
+	return p[0]
+}
+
+func (p Polygon) Interiors() []Coordinates {
+	if len(p) < 2 {
+		return nil
+	}
+	return p[1:]
+}
+
+func (p Polygon) Bbox() Bbox {
+	return p.Exterior().Bbox()
+}
+
+func (points MultiPoint) Bbox() Bbox {
+	return Coordinates(points).Bbox()
+}
+
+func (polygons MultiPolygon) Bbox() Bbox {
+	bb := EmptyBbox()
+	for _, polygon := range polygons {
+		bb = bb.Union(polygon.Bbox())
+	}
+	return bb
+}
+
+func (gc GeometryCollection) Bbox() Bbox {
+	bb := EmptyBbox()
+	for _, g := range gc {
+		bb = bb.Union(g.Bbox())
 	}
 	return bb
 }
@@ -5,13 +5,99 @@
 package geom
 
 import (
+	"math"
 	"testing"
 )
 
 func TestBboxOverlap(t *testing.T) {
-	bb := Bbox{-118.944862413904, 34.823301, -117.646374, 32.801462}
-	b3 := Bbox{-118.30078125, 36.21093749999999, -118.125, 36.03515625}
+	bb := Bbox{-118.944862413904, 32.801462, -117.646374, 34.823301}
+	b3 := Bbox{-118.30078125, 36.03515625, -118.125, 36.21093749999999}
 	if bb.Overlaps(b3) {
 		t.Error("these shapes don't overlap")
 	}
 }
+
+func TestNewBbox(t *testing.T) {
+	expected := Bbox{MinX: -1, MinY: -2, MaxX: 3, MaxY: 4}
+	for _, bb := range []Bbox{NewBbox(-1, -2, 3, 4), NewBbox(3, 4, -1, -2), NewBbox(-1, 4, 3, -2)} {
+		if bb != expected {
+			t.Errorf("expected %v, got %v", expected, bb)
+		}
+	}
+	if bb := expected; bb.Width() != 4 || bb.Height() != 6 {
+		t.Errorf("expected a 4x6 box, got %vx%v", bb.Width(), bb.Height())
+	}
+	if c := expected.Center(); c != (Point{1, 1}) {
+		t.Errorf("expected the center to be (1, 1), got %v", c)
+	}
+}
+
+func TestBboxAlgebra(t *testing.T) {
+	a := Bbox{0, 0, 10, 10}
+	b := Bbox{5, 5, 15, 15}
+	edge := Bbox{10, 0, 20, 10}
+	apart := Bbox{11, 11, 12, 12}
+	empty := EmptyBbox()
+
+	if u := a.Union(b); u != (Bbox{0, 0, 15, 15}) {
+		t.Errorf("union: got %v", u)
+	}
+	if u := a.Union(empty); u != a {
+		t.Errorf("union with nothing: got %v", u)
+	}
+	if u := empty.Union(a); u != a {
+		t.Errorf("union of nothing: got %v", u)
+	}
+	if i := a.Intersection(b); i != (Bbox{5, 5, 10, 10}) {
+		t.Errorf("intersection: got %v", i)
+	}
+	if i := a.Intersection(edge); i != (Bbox{10, 0, 10, 10}) || i.IsEmpty() {
+		t.Errorf("intersection along an edge: got %v", i)
+	}
+	if i := a.Intersection(apart); !i.IsEmpty() {
+		t.Errorf("expected boxes that don't meet to have an empty intersection, got %v", i)
+	}
+
+	if !a.Intersects(edge) || a.Overlaps(edge) {
+		t.Error("boxes sharing an edge intersect but don't overlap")
+	}
+	if a.Intersects(apart) || a.Intersects(empty) || empty.Intersects(empty) {
+		t.Error("expected no intersection")
+	}
+	if !a.Contains(Bbox{0, 0, 5, 10}) || a.Contains(b) || a.Contains(empty) || empty.Contains(a) {
+		t.Error("contains is wrong")
+	}
+	if !a.ContainsPoint(Point{10, 0}) || a.ContainsPoint(Point{10, -1}) {
+		t.Error("contains point is wrong")
+	}
+	if bb := a.Buffer(2); bb != (Bbox{-2, -2, 12, 12}) {
+		t.Errorf("buffer: got %v", bb)
+	}
+	if bb := a.Buffer(-6); !bb.IsEmpty() {
+		t.Errorf("expected shrinking past the middle to leave nothing, got %v", bb)
+	}
+	if !empty.Buffer(1).IsEmpty() || empty.Width() != 0 || empty.Height() != 0 {
+		t.Error("an empty box has no size")
+	}
+}
+
+func TestBboxOfEmpty(t *testing.T) {
+	for _, g := range []Geometry{
+		Coordinates{},
+		Multiline{},
+		Polygon{},
+		MultiPoint{},
+		MultiPolygon{},
+		GeometryCollection{},
+		Point{math.NaN(), math.NaN()},
+		GeometryCollection{Point{math.NaN(), math.NaN()}, Coordinates{}},
+	} {
+		if bb := g.Bbox(); !bb.IsEmpty() {
+			t.Errorf("expected %#v to have an empty bbox, got %v", g, bb)
+		}
+	}
+	gc := GeometryCollection{Coordinates{}, Point{1, 2}, Coordinates{{3, -1}, {0, 0}}}
+	if bb := gc.Bbox(); bb != (Bbox{0, -1, 3, 2}) {
+		t.Errorf("expected empty members to be skipped, got %v", bb)
+	}
+}
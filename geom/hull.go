@@ -0,0 +1,187 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// Envelope is the bounding box of g as a polygon, or nil if g is empty.
+func Envelope(g Geometry) Polygon {
+	bb := g.Bbox()
+	if bb.IsEmpty() {
+		return nil
+	}
+	return bb.Polygon()
+}
+
+// distinctPoints sorts the finite points by x and then y, and drops
+// the repeats.
+func distinctPoints(points MultiPoint) MultiPoint {
+	var sorted MultiPoint
+	for _, p := range points {
+		if finite(p) {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	distinct := sorted[:0]
+	for i, p := range sorted {
+		if i == 0 || p != sorted[i-1] {
+			distinct = append(distinct, p)
+		}
+	}
+	return distinct
+}
+
+// ConvexHull is the smallest convex polygon that holds all the points,
+// wound anticlockwise.  It is nil if there are fewer than three points
+// that aren't in a line.  It uses Andrew's monotone chain.
+func ConvexHull(points MultiPoint) Polygon {
+	pts := distinctPoints(points)
+	if len(pts) < 3 {
+		return nil
+	}
+	chain := func(pts MultiPoint) Coordinates {
+		var half Coordinates
+		for _, p := range pts {
+			for len(half) >= 2 && orient(half[len(half)-2], half[len(half)-1], p) <= 0 {
+				half = half[:len(half)-1]
+			}
+			half = append(half, p)
+		}
+		return half[:len(half)-1]
+	}
+	lower := chain(pts)
+	backwards := make(MultiPoint, len(pts))
+	for i, p := range pts {
+		backwards[len(pts)-1-i] = p
+	}
+	hull := append(lower, chain(backwards)...)
+	if len(hull) < 3 {
+		return nil
+	}
+	return Polygon{append(hull, hull[0])}
+}
+
+// ConcaveHull is a polygon that holds all the points and follows them
+// more closely than their convex hull.  Starting from the Delaunay
+// triangulation, the longest edge on the outside is taken away with
+// its triangle for as long as it is longer than maxEdge, so long as the
+// polygon stays in one piece with every point on or inside it
+// (Duckham et al., "Efficient generation of simple polygons for
+// characterizing the shape of a set of points in the plane").  A
+// maxEdge of zero or less gives the convex hull.
+func ConcaveHull(points MultiPoint, maxEdge float64) Polygon {
+	if maxEdge <= 0 {
+		return ConvexHull(points)
+	}
+	t := Delaunay(points)
+	if len(t.Triangles) == 0 {
+		return nil
+	}
+	// every triangle winds anticlockwise, so each directed edge belongs
+	// to at most one, which has it on its left
+	type edge [2]int
+	owner := make(map[edge]int)
+	for i, tri := range t.Triangles {
+		for k := 0; k < 3; k++ {
+			owner[edge{tri[k], tri[(k+1)%3]}] = i
+		}
+	}
+	alive := make([]bool, len(t.Triangles))
+	for i := range alive {
+		alive[i] = true
+	}
+	isBoundary := func(e edge) bool {
+		i, ok := owner[e]
+		if !ok || !alive[i] {
+			return false
+		}
+		j, ok := owner[edge{e[1], e[0]}]
+		return !ok || !alive[j]
+	}
+	length := func(e edge) float64 {
+		a, b := t.Points[e[0]], t.Points[e[1]]
+		return math.Hypot(b[0]-a[0], b[1]-a[1])
+	}
+
+	onBoundary := make([]bool, len(t.Points))
+	var queue hullQueue
+	for e := range owner {
+		if isBoundary(e) {
+			onBoundary[e[0]], onBoundary[e[1]] = true, true
+			heap.Push(&queue, hullEdge{e, length(e)})
+		}
+	}
+	for queue.Len() > 0 {
+		next := heap.Pop(&queue).(hullEdge)
+		e := edge(next.e)
+		if next.length <= maxEdge {
+			break
+		}
+		if !isBoundary(e) {
+			continue
+		}
+		i := owner[e]
+		tri := t.Triangles[i]
+		v := tri[0] + tri[1] + tri[2] - e[0] - e[1]
+		if onBoundary[v] {
+			// taking the triangle away would pinch the polygon at v
+			continue
+		}
+		alive[i] = false
+		onBoundary[v] = true
+		for _, inner := range []edge{{e[0], v}, {v, e[1]}} {
+			heap.Push(&queue, hullEdge{inner, length(inner)})
+		}
+	}
+
+	following := make(map[int]int)
+	start := -1
+	for e := range owner {
+		if isBoundary(e) {
+			following[e[0]] = e[1]
+			if start < 0 || e[0] < start {
+				start = e[0]
+			}
+		}
+	}
+	ring := Coordinates{t.Points[start]}
+	for at := following[start]; at != start; at = following[at] {
+		ring = append(ring, t.Points[at])
+		if len(ring) > len(following) {
+			return ConvexHull(points)
+		}
+	}
+	return Polygon{append(ring, ring[0])}
+}
+
+type hullEdge struct {
+	e      [2]int
+	length float64
+}
+
+// hullQueue puts the longest edge first.
+type hullQueue []hullEdge
+
+func (q hullQueue) Len() int            { return len(q) }
+func (q hullQueue) Less(i, j int) bool  { return q[i].length > q[j].length }
+func (q hullQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *hullQueue) Push(x interface{}) { *q = append(*q, x.(hullEdge)) }
+
+func (q *hullQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"testing"
+)
+
+func TestConvexHull(t *testing.T) {
+	points := MultiPoint{{0, 0}, {4, 0}, {2, 1}, {4, 4}, {2, 2}, {0, 4}, {2, 4}, {0, 0}}
+	hull := ConvexHull(points)
+	if expected := "POLYGON ((0 0, 4 0, 4 4, 0 4, 0 0))"; wkt(t, hull) != expected {
+		t.Errorf("expected %s, got %s", expected, wkt(t, hull))
+	}
+	if hull := ConvexHull(MultiPoint{{0, 0}, {1, 1}, {2, 2}}); hull != nil {
+		t.Errorf("expected points in a line to have no hull, got %s", wkt(t, hull))
+	}
+	if env := Envelope(Coordinates{{1, 2}, {3, 1}}); wkt(t, env) != "POLYGON ((1 1, 3 1, 3 2, 1 2, 1 1))" {
+		t.Errorf("unexpected envelope %s", wkt(t, env))
+	}
+}
+
+func TestConcaveHull(t *testing.T) {
+	// a U of points, with a notch the convex hull would fill in
+	var points MultiPoint
+	for i := 0; i <= 10; i++ {
+		x := float64(i)
+		points = append(points, Point{x, 0}, Point{x, 1})
+		if i < 2 || i > 8 {
+			for y := 2.0; y <= 10; y++ {
+				points = append(points, Point{x, y})
+			}
+		}
+	}
+	convex := ConvexHull(points)
+	if Area(convex) != 100 {
+		t.Errorf("expected the convex hull to be the whole square, got %s", wkt(t, convex))
+	}
+	concave := ConcaveHull(points, 1.5)
+	if len(concave) != 1 || concave.Exterior().IsClockwise() || ringsCross(concave) {
+		t.Fatalf("expected a simple anticlockwise ring, got %s", wkt(t, concave))
+	}
+	// the notch is 8 wide and 9 deep, less the two triangles cut
+	// across its inside corners
+	if expected, area := 100-8*9+1.0, Area(concave); area != expected {
+		t.Errorf("expected the notch to be left out, for an area of %v, got %v", expected, area)
+	}
+	for _, p := range points {
+		if locatePolygon(p, concave) == Exterior {
+			t.Errorf("%v was left outside of the concave hull", p)
+		}
+	}
+	if all := ConcaveHull(points, 0); Area(all) != 100 {
+		t.Errorf("expected no limit to give the convex hull, got %s", wkt(t, all))
+	}
+}
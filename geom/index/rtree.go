@@ -0,0 +1,470 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package index provides an R-tree for finding things by where they
+// are.
+package index
+
+import (
+	"container/heap"
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"sort"
+)
+
+// An Item is anything with a bounding box.  Every geom.Geometry and
+// geom.Shape is one.  Items are compared with == when deleting, so they
+// should usually be pointers.
+type Item interface {
+	Bbox() geom.Bbox
+}
+
+// DefaultMaxEntries is how many entries a node holds when no other
+// number is given.
+const DefaultMaxEntries = 9
+
+// RTree is a balanced tree of bounding boxes.  It can be built all at
+// once with Load, which packs it tightly, or grown one item at a time.
+// It isn't safe for concurrent writes.
+type RTree struct {
+	root       *node
+	size       int
+	maxEntries int
+	minEntries int
+}
+
+type node struct {
+	bbox    geom.Bbox
+	entries []entry
+	// height is 1 for leaves, whose entries hold items, and one more
+	// than their children for every other node
+	height int
+}
+
+type entry struct {
+	bbox  geom.Bbox
+	child *node
+	item  Item
+}
+
+// New makes an empty tree whose nodes hold at most maxEntries entries.
+// Anything less than 4 uses DefaultMaxEntries.
+func New(maxEntries int) *RTree {
+	if maxEntries < 4 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &RTree{
+		root:       newNode(1),
+		maxEntries: maxEntries,
+		minEntries: int(math.Max(2, math.Ceil(float64(maxEntries)*0.4))),
+	}
+}
+
+// Load makes a tree holding items, packed with the Sort-Tile-Recursive
+// algorithm (Leutenegger et al.).  Items with empty bounds are skipped.
+func Load(maxEntries int, items []Item) *RTree {
+	t := New(maxEntries)
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		if bb := item.Bbox(); !bb.IsEmpty() {
+			entries = append(entries, entry{bbox: bb, item: item})
+		}
+	}
+	t.size = len(entries)
+	height := 1
+	for {
+		var nodes []entry
+		for _, group := range t.pack(entries) {
+			n := &node{entries: group, height: height}
+			n.refit()
+			nodes = append(nodes, entry{bbox: n.bbox, child: n})
+		}
+		if len(nodes) <= 1 {
+			if len(nodes) == 1 {
+				t.root = nodes[0].child
+			}
+			return t
+		}
+		entries = nodes
+		height++
+	}
+}
+
+// pack tiles entries into groups of at most maxEntries: it cuts them
+// into vertical slices by x, then each slice into runs by y.  Slices
+// and runs are kept about the same size, so that none is left nearly
+// empty.
+func (t *RTree) pack(entries []entry) [][]entry {
+	if len(entries) <= t.maxEntries {
+		return [][]entry{entries}
+	}
+	groups := math.Ceil(float64(len(entries)) / float64(t.maxEntries))
+	slices := int(math.Ceil(math.Sqrt(groups)))
+
+	sortBy(entries, 0)
+	var packed [][]entry
+	for _, slice := range split(entries, slices) {
+		sortBy(slice, 1)
+		runs := (len(slice) + t.maxEntries - 1) / t.maxEntries
+		for _, group := range split(slice, runs) {
+			packed = append(packed, append([]entry(nil), group...))
+		}
+	}
+	return packed
+}
+
+// split cuts entries into n pieces whose sizes differ by at most one.
+func split(entries []entry, n int) [][]entry {
+	pieces := make([][]entry, n)
+	for i := range pieces {
+		pieces[i] = entries[i*len(entries)/n : (i+1)*len(entries)/n]
+	}
+	return pieces
+}
+
+// sortBy orders entries by the centre of their bounds on an axis.
+func sortBy(entries []entry, axis int) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].bbox.Center()[axis] < entries[j].bbox.Center()[axis]
+	})
+}
+
+func newNode(height int) *node {
+	return &node{bbox: geom.EmptyBbox(), height: height}
+}
+
+func (n *node) leaf() bool {
+	return n.height == 1
+}
+
+// refit recomputes the bounds of the node from its entries.
+func (n *node) refit() {
+	n.bbox = geom.EmptyBbox()
+	for _, e := range n.entries {
+		n.bbox = n.bbox.Union(e.bbox)
+	}
+}
+
+// Len is the number of items in the tree.
+func (t *RTree) Len() int {
+	return t.size
+}
+
+// Bbox is the bounds of everything in the tree.
+func (t *RTree) Bbox() geom.Bbox {
+	return t.root.bbox
+}
+
+// Insert adds an item to the tree.  Items with empty bounds can't be
+// found, so they aren't added.
+func (t *RTree) Insert(item Item) {
+	bb := item.Bbox()
+	if bb.IsEmpty() {
+		return
+	}
+	t.insert(entry{bbox: bb, item: item}, 1)
+	t.size++
+}
+
+// insert puts e into a node at the given height, splitting any nodes
+// that overflow on the way back up.
+func (t *RTree) insert(e entry, height int) {
+	path := []*node{t.root}
+	n := t.root
+	for n.height > height {
+		n = n.chooseSubtree(e.bbox)
+		path = append(path, n)
+	}
+	n.entries = append(n.entries, e)
+	n.bbox = n.bbox.Union(e.bbox)
+
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		if i+1 < len(path) {
+			n.setChildBbox(path[i+1])
+		}
+		if len(n.entries) <= t.maxEntries {
+			n.refit()
+			continue
+		}
+		sibling := t.split(n)
+		if i > 0 {
+			parent := path[i-1]
+			parent.entries = append(parent.entries, entry{bbox: sibling.bbox, child: sibling})
+			continue
+		}
+		t.root = &node{height: n.height + 1, entries: []entry{
+			{bbox: n.bbox, child: n},
+			{bbox: sibling.bbox, child: sibling},
+		}}
+		t.root.refit()
+	}
+}
+
+// chooseSubtree picks the child that needs to grow the least to take
+// bb, preferring the smaller child when that's a tie.
+func (n *node) chooseSubtree(bb geom.Bbox) *node {
+	var best *node
+	bestGrowth, bestArea := math.Inf(1), math.Inf(1)
+	for _, e := range n.entries {
+		area := e.bbox.Width() * e.bbox.Height()
+		u := e.bbox.Union(bb)
+		growth := u.Width()*u.Height() - area
+		if growth < bestGrowth || growth == bestGrowth && area < bestArea {
+			best, bestGrowth, bestArea = e.child, growth, area
+		}
+	}
+	return best
+}
+
+func (n *node) setChildBbox(child *node) {
+	for i := range n.entries {
+		if n.entries[i].child == child {
+			n.entries[i].bbox = child.bbox
+			return
+		}
+	}
+}
+
+// split moves some of the entries of an overflowing node into a new
+// sibling.  The entries are sorted along whichever axis gives the
+// groups the smallest margins, and cut where the two groups overlap
+// the least.
+func (t *RTree) split(n *node) *node {
+	best := math.Inf(1)
+	axis := 0
+	for a := 0; a < 2; a++ {
+		sortBy(n.entries, a)
+		if m := t.marginSum(n.entries); m < best {
+			best, axis = m, a
+		}
+	}
+	sortBy(n.entries, axis)
+
+	cut := t.minEntries
+	bestOverlap, bestArea := math.Inf(1), math.Inf(1)
+	for i := t.minEntries; i <= len(n.entries)-t.minEntries; i++ {
+		left, right := bboxOf(n.entries[:i]), bboxOf(n.entries[i:])
+		overlap := left.Intersection(right)
+		o := overlap.Width() * overlap.Height()
+		area := left.Width()*left.Height() + right.Width()*right.Height()
+		if o < bestOverlap || o == bestOverlap && area < bestArea {
+			cut, bestOverlap, bestArea = i, o, area
+		}
+	}
+
+	sibling := &node{height: n.height, entries: append([]entry(nil), n.entries[cut:]...)}
+	n.entries = append([]entry(nil), n.entries[:cut]...)
+	n.refit()
+	sibling.refit()
+	return sibling
+}
+
+// marginSum adds up the margins of every way of cutting entries in two.
+func (t *RTree) marginSum(entries []entry) float64 {
+	var sum float64
+	for i := t.minEntries; i <= len(entries)-t.minEntries; i++ {
+		left, right := bboxOf(entries[:i]), bboxOf(entries[i:])
+		sum += left.Width() + left.Height() + right.Width() + right.Height()
+	}
+	return sum
+}
+
+func bboxOf(entries []entry) geom.Bbox {
+	bb := geom.EmptyBbox()
+	for _, e := range entries {
+		bb = bb.Union(e.bbox)
+	}
+	return bb
+}
+
+// Delete removes an item from the tree, and reports whether it was
+// there.  Nodes left with too few entries are dissolved and what they
+// held is put back into the tree.
+func (t *RTree) Delete(item Item) bool {
+	bb := item.Bbox()
+	path := t.find(t.root, item, bb, nil)
+	if path == nil {
+		return false
+	}
+	leaf := path[len(path)-1]
+	for i, e := range leaf.entries {
+		if e.item == item {
+			leaf.entries = append(leaf.entries[:i], leaf.entries[i+1:]...)
+			break
+		}
+	}
+	t.size--
+
+	var orphans []entry
+	for i := len(path) - 1; i > 0; i-- {
+		n, parent := path[i], path[i-1]
+		if len(n.entries) < t.minEntries {
+			orphans = append(orphans, n.entries...)
+			for j, e := range parent.entries {
+				if e.child == n {
+					parent.entries = append(parent.entries[:j], parent.entries[j+1:]...)
+					break
+				}
+			}
+		} else {
+			n.refit()
+			parent.setChildBbox(n)
+		}
+	}
+	t.root.refit()
+	for len(t.root.entries) == 1 && !t.root.leaf() {
+		t.root = t.root.entries[0].child
+	}
+	if len(t.root.entries) == 0 {
+		t.root = newNode(1)
+	}
+	for _, e := range orphans {
+		t.reinsert(e)
+	}
+	return true
+}
+
+// reinsert puts back an entry from a dissolved node, at the same
+// height it was at so that the tree stays balanced.
+func (t *RTree) reinsert(e entry) {
+	height := 1
+	if e.child != nil {
+		height = e.child.height + 1
+	}
+	if height > t.root.height {
+		// the tree has shrunk below the entry, so take it apart
+		for _, child := range e.child.entries {
+			t.reinsert(child)
+		}
+		return
+	}
+	t.insert(e, height)
+}
+
+// find returns the path from n down to the leaf holding item.
+func (t *RTree) find(n *node, item Item, bb geom.Bbox, path []*node) []*node {
+	path = append(path, n)
+	for _, e := range n.entries {
+		if !e.bbox.Contains(bb) {
+			continue
+		}
+		if n.leaf() {
+			if e.item == item {
+				return path
+			}
+		} else if found := t.find(e.child, item, bb, path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Search finds every item whose bounds meet bb, edges included.
+func (t *RTree) Search(bb geom.Bbox) []Item {
+	var items []Item
+	t.SearchFunc(bb, func(item Item) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
+}
+
+// SearchFunc calls fn with every item whose bounds meet bb, until fn
+// returns false.
+func (t *RTree) SearchFunc(bb geom.Bbox, fn func(Item) bool) {
+	if t.root.bbox.Intersects(bb) {
+		search(t.root, bb, fn)
+	}
+}
+
+func search(n *node, bb geom.Bbox, fn func(Item) bool) bool {
+	for _, e := range n.entries {
+		if !e.bbox.Intersects(bb) {
+			continue
+		}
+		if n.leaf() {
+			if !fn(e.item) {
+				return false
+			}
+		} else if !search(e.child, bb, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Collides reports whether anything in the tree meets bb.
+func (t *RTree) Collides(bb geom.Bbox) bool {
+	collides := false
+	t.SearchFunc(bb, func(Item) bool {
+		collides = true
+		return false
+	})
+	return collides
+}
+
+// A Distance measures how far an item is from a point.  It must never
+// be less than the distance to the bounds of the item.
+type Distance func(p geom.Point, item Item) float64
+
+// BboxDistance is the distance from p to the nearest edge of the bounds
+// of the item, or zero if p is inside them.
+func BboxDistance(p geom.Point, item Item) float64 {
+	return bboxDistance(p, item.Bbox())
+}
+
+func bboxDistance(p geom.Point, bb geom.Bbox) float64 {
+	dx := math.Max(0, math.Max(bb.MinX-p[0], p[0]-bb.MaxX))
+	dy := math.Max(0, math.Max(bb.MinY-p[1], p[1]-bb.MaxY))
+	return math.Hypot(dx, dy)
+}
+
+// Nearest finds the k items closest to p, closest first, measured with
+// dist; a nil dist uses BboxDistance.  Nodes are visited in order of
+// how close they could be, so only those that might hold one of the k
+// are opened.
+func (t *RTree) Nearest(p geom.Point, k int, dist Distance) []Item {
+	if dist == nil {
+		dist = BboxDistance
+	}
+	var items []Item
+	queue := &nearestQueue{{node: t.root, dist: bboxDistance(p, t.root.bbox)}}
+	for queue.Len() > 0 && len(items) < k {
+		c := heap.Pop(queue).(nearestCandidate)
+		switch {
+		case c.node == nil:
+			items = append(items, c.item)
+		case c.node.leaf():
+			for _, e := range c.node.entries {
+				heap.Push(queue, nearestCandidate{item: e.item, dist: dist(p, e.item)})
+			}
+		default:
+			for _, e := range c.node.entries {
+				heap.Push(queue, nearestCandidate{node: e.child, dist: bboxDistance(p, e.bbox)})
+			}
+		}
+	}
+	return items
+}
+
+type nearestCandidate struct {
+	node *node
+	item Item
+	dist float64
+}
+
+type nearestQueue []nearestCandidate
+
+func (q nearestQueue) Len() int            { return len(q) }
+func (q nearestQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q nearestQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nearestQueue) Push(x interface{}) { *q = append(*q, x.(nearestCandidate)) }
+
+func (q *nearestQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
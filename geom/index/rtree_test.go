@@ -0,0 +1,280 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type box struct {
+	id int
+	bb geom.Bbox
+}
+
+func (b *box) Bbox() geom.Bbox { return b.bb }
+
+func randomBoxes(r *rand.Rand, n int, size float64) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		x, y := r.Float64()*1000, r.Float64()*1000
+		items[i] = &box{i, geom.NewBbox(x, y, x+r.Float64()*size, y+r.Float64()*size)}
+	}
+	return items
+}
+
+// bruteSearch is what Search should find.
+func bruteSearch(items []Item, bb geom.Bbox) []int {
+	var ids []int
+	for _, item := range items {
+		if item.Bbox().Intersects(bb) {
+			ids = append(ids, item.(*box).id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func ids(items []Item) []int {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.(*box).id
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTree makes sure every leaf is at the same depth, that every
+// bounding box is exactly the union of what's under it, and that no
+// node but the root is too full or too empty.
+func checkTree(t *testing.T, tree *RTree) {
+	count := 0
+	var walk func(n *node, root bool)
+	walk = func(n *node, root bool) {
+		if !root && (len(n.entries) < tree.minEntries || len(n.entries) > tree.maxEntries) {
+			t.Fatalf("node at height %d has %d entries", n.height, len(n.entries))
+		}
+		bb := geom.EmptyBbox()
+		for _, e := range n.entries {
+			bb = bb.Union(e.bbox)
+			if n.leaf() {
+				count++
+				if e.child != nil || e.bbox != e.item.Bbox() {
+					t.Fatal("bad leaf entry")
+				}
+				continue
+			}
+			if e.child.height != n.height-1 {
+				t.Fatalf("child of height %d under node of height %d", e.child.height, n.height)
+			}
+			if e.bbox != e.child.bbox {
+				t.Fatalf("entry bounds %v don't match child bounds %v", e.bbox, e.child.bbox)
+			}
+			walk(e.child, false)
+		}
+		if bb != n.bbox && !(bb.IsEmpty() && n.bbox.IsEmpty()) {
+			t.Fatalf("node bounds %v, expected %v", n.bbox, bb)
+		}
+	}
+	walk(tree.root, true)
+	if count != tree.Len() {
+		t.Fatalf("found %d items, but Len is %d", count, tree.Len())
+	}
+}
+
+func checkSearches(t *testing.T, r *rand.Rand, tree *RTree, items []Item) {
+	for i := 0; i < 50; i++ {
+		x, y := r.Float64()*1000, r.Float64()*1000
+		bb := geom.NewBbox(x, y, x+r.Float64()*200, y+r.Float64()*200)
+		if found, expected := ids(tree.Search(bb)), bruteSearch(items, bb); !sameInts(found, expected) {
+			t.Fatalf("search %v: expected %v, found %v", bb, expected, found)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 9, 10, 100, 1000} {
+		items := randomBoxes(r, n, 20)
+		tree := Load(9, items)
+		checkTree(t, tree)
+		checkSearches(t, r, tree, items)
+	}
+}
+
+func TestInsertAndDelete(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	items := randomBoxes(r, 1000, 20)
+	tree := New(6)
+	for _, item := range items {
+		tree.Insert(item)
+	}
+	checkTree(t, tree)
+	checkSearches(t, r, tree, items)
+
+	r.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	for len(items) > 0 {
+		if !tree.Delete(items[0]) {
+			t.Fatalf("couldn't delete %v", items[0])
+		}
+		if tree.Delete(items[0]) {
+			t.Fatalf("deleted %v twice", items[0])
+		}
+		items = items[1:]
+		if len(items)%97 == 0 {
+			checkTree(t, tree)
+			checkSearches(t, r, tree, items)
+		}
+	}
+	if tree.Len() != 0 || !tree.Bbox().IsEmpty() {
+		t.Errorf("expected an empty tree, got %d items in %v", tree.Len(), tree.Bbox())
+	}
+
+	tree.Insert(&box{0, geom.EmptyBbox()})
+	if tree.Len() != 0 {
+		t.Error("expected items without bounds to be left out")
+	}
+}
+
+func TestLoadThenInsert(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	items := randomBoxes(r, 500, 20)
+	tree := Load(0, items[:250])
+	for _, item := range items[250:] {
+		tree.Insert(item)
+	}
+	for _, item := range items[:100] {
+		tree.Delete(item)
+	}
+	checkTree(t, tree)
+	checkSearches(t, r, tree, items[100:])
+}
+
+func TestNearest(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	items := randomBoxes(r, 1000, 0)
+	tree := Load(0, items)
+	for i := 0; i < 20; i++ {
+		p := geom.Point{r.Float64() * 1000, r.Float64() * 1000}
+		found := tree.Nearest(p, 10, nil)
+		sorted := append([]Item(nil), items...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return BboxDistance(p, sorted[i]) < BboxDistance(p, sorted[j])
+		})
+		for j, item := range found {
+			if BboxDistance(p, item) != BboxDistance(p, sorted[j]) {
+				t.Fatalf("neighbour %d of %v: expected %v, got %v", j, p, sorted[j], item)
+			}
+		}
+		if len(found) != 10 {
+			t.Fatalf("expected 10 neighbours, got %d", len(found))
+		}
+	}
+	if found := tree.Nearest(geom.Point{0, 0}, 2000, nil); len(found) != len(items) {
+		t.Errorf("expected every item when asking for more than there are, got %d", len(found))
+	}
+}
+
+func TestNearestWithDistance(t *testing.T) {
+	// a long diagonal line whose bounds hold the point, and a small
+	// square that is actually closer to it
+	line := &box{0, geom.NewBbox(0, 0, 10, 10)}
+	square := &box{1, geom.NewBbox(8, 1, 9, 2)}
+	tree := Load(0, []Item{line, square})
+	p := geom.Point{9, 0}
+	dist := func(p geom.Point, item Item) float64 {
+		if item == line {
+			// the distance to the line y = x
+			return math.Abs(p[0]-p[1]) / math.Sqrt2
+		}
+		return BboxDistance(p, item)
+	}
+	if found := tree.Nearest(p, 1, nil); found[0] != line {
+		t.Error("expected the line's bounds to be closest")
+	}
+	if found := tree.Nearest(p, 1, dist); found[0] != square {
+		t.Error("expected the square to be closest")
+	}
+}
+
+func TestCollides(t *testing.T) {
+	tree := New(0)
+	tree.Insert(geom.NewBbox(0, 0, 10, 10).Polygon())
+	if !tree.Collides(geom.NewBbox(10, 10, 20, 20)) {
+		t.Error("expected touching boxes to collide")
+	}
+	if tree.Collides(geom.NewBbox(11, 11, 20, 20)) {
+		t.Error("expected boxes apart not to collide")
+	}
+}
+
+func benchmarkItems(n int) []Item {
+	return randomBoxes(rand.New(rand.NewSource(42)), n, 5)
+}
+
+func BenchmarkLoad(b *testing.B) {
+	items := benchmarkItems(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Load(0, items)
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	items := benchmarkItems(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree := New(0)
+		for _, item := range items {
+			tree.Insert(item)
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	tree := Load(0, benchmarkItems(10000))
+	r := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := r.Float64()*1000, r.Float64()*1000
+		tree.Search(geom.NewBbox(x, y, x+10, y+10))
+	}
+}
+
+func BenchmarkNearest(b *testing.B) {
+	tree := Load(0, benchmarkItems(10000))
+	r := rand.New(rand.NewSource(7))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Nearest(geom.Point{r.Float64() * 1000, r.Float64() * 1000}, 5, nil)
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	items := benchmarkItems(10000)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := Load(0, items)
+		b.StartTimer()
+		for _, item := range items[:1000] {
+			tree.Delete(item)
+		}
+	}
+}
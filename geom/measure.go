@@ -0,0 +1,254 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"container/heap"
+	"math"
+)
+
+// EarthRadius is the radius of the sphere used for geodesic
+// measurements, in metres.  It is the WGS 84 semi-major axis.
+const EarthRadius = 6378137.0
+
+// Area is the planar area of the polygons in g, less their holes.
+// Points and lines have no area.
+func Area(g Geometry) float64 {
+	var area float64
+	for _, polygon := range polygonsOf(g) {
+		area += polygonArea(polygon, func(ring Coordinates) float64 {
+			return math.Abs(signedArea(ring))
+		})
+	}
+	return area
+}
+
+// GeodesicArea is the area of the polygons in g on a sphere of
+// EarthRadius, in square metres.  Coordinates are longitude and
+// latitude in radians.
+func GeodesicArea(g Geometry) float64 {
+	var area float64
+	for _, polygon := range polygonsOf(g) {
+		area += polygonArea(polygon, sphericalArea)
+	}
+	return area
+}
+
+func polygonArea(polygon Polygon, ringArea func(Coordinates) float64) float64 {
+	if len(polygon) == 0 {
+		return 0
+	}
+	area := ringArea(polygon.Exterior())
+	for _, hole := range polygon.Interiors() {
+		area -= ringArea(hole)
+	}
+	return area
+}
+
+// sphericalArea is the area enclosed by a ring on the sphere, after
+// Chamberlain and Duquette, "Some Algorithms for Polygons on a Sphere".
+func sphericalArea(ring Coordinates) float64 {
+	var sum float64
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		sum += (b[0] - a[0]) * (2 + math.Sin(a[1]) + math.Sin(b[1]))
+	}
+	return math.Abs(sum) * EarthRadius * EarthRadius / 2
+}
+
+// Length is the planar length of the lines in g, or the perimeter of
+// its polygons, counting their holes.
+func Length(g Geometry) float64 {
+	var length float64
+	for _, s := range segmentsOf(g) {
+		length += math.Hypot(s[1][0]-s[0][0], s[1][1]-s[0][1])
+	}
+	return length
+}
+
+// GeodesicLength is the length of g along great circles on a sphere of
+// EarthRadius, in metres.  Coordinates are longitude and latitude in
+// radians.
+func GeodesicLength(g Geometry) float64 {
+	var length float64
+	for _, s := range segmentsOf(g) {
+		length += haversine(s[0], s[1])
+	}
+	return length * EarthRadius
+}
+
+// haversine is the angle between two points on the sphere.
+func haversine(a, b Point) float64 {
+	dlat := math.Sin((b[1] - a[1]) / 2)
+	dlng := math.Sin((b[0] - a[0]) / 2)
+	h := dlat*dlat + math.Cos(a[1])*math.Cos(b[1])*dlng*dlng
+	return 2 * math.Asin(math.Sqrt(math.Min(1, h)))
+}
+
+// Centroid is the centre of mass of g.  Only the parts of the highest
+// dimension count: the polygons if there are any, weighted by area,
+// then the lines, weighted by length, and otherwise the points.  It
+// need not fall inside g; use LabelPoint for that.  The centroid of an
+// empty geometry is NaN.
+func Centroid(g Geometry) Point {
+	var cx, cy, total float64
+	for _, polygon := range polygonsOf(g) {
+		for i, ring := range polygon {
+			x, y, area := ringCentroid(ring)
+			area = math.Abs(area)
+			if i > 0 {
+				area = -area
+			}
+			cx, cy, total = cx+x*area, cy+y*area, total+area
+		}
+	}
+	if total > 0 {
+		return Point{cx / total, cy / total}
+	}
+
+	cx, cy, total = 0, 0, 0
+	for _, s := range segmentsOf(g) {
+		length := math.Hypot(s[1][0]-s[0][0], s[1][1]-s[0][1])
+		cx += (s[0][0] + s[1][0]) / 2 * length
+		cy += (s[0][1] + s[1][1]) / 2 * length
+		total += length
+	}
+	if total > 0 {
+		return Point{cx / total, cy / total}
+	}
+
+	points := verticesOf(g)
+	if len(points) == 0 {
+		return Point{math.NaN(), math.NaN()}
+	}
+	for _, p := range points {
+		cx, cy = cx+p[0], cy+p[1]
+	}
+	return Point{cx / float64(len(points)), cy / float64(len(points))}
+}
+
+// ringCentroid returns the centroid of the area of a ring, along with
+// its signed area.
+func ringCentroid(ring Coordinates) (float64, float64, float64) {
+	var cx, cy float64
+	area := signedArea(ring)
+	if area == 0 {
+		return 0, 0, 0
+	}
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		cross := a[0]*b[1] - b[0]*a[1]
+		cx += (a[0] + b[0]) * cross
+		cy += (a[1] + b[1]) * cross
+	}
+	return cx / (6 * area), cy / (6 * area), area
+}
+
+// LabelPoint is a good place to put a label on g.  For polygons it is
+// the pole of inaccessibility of the largest one: the point inside it
+// that is furthest from its boundary, found to within precision.
+// Other geometries use their centroid.
+func LabelPoint(g Geometry, precision float64) Point {
+	var largest Polygon
+	best := 0.0
+	for _, polygon := range polygonsOf(g) {
+		if area := Area(polygon); area > best {
+			largest, best = polygon, area
+		}
+	}
+	if largest == nil {
+		return Centroid(g)
+	}
+	return poleOfInaccessibility(largest, precision)
+}
+
+// poleOfInaccessibility covers the polygon with square cells and keeps
+// splitting the ones that could still hold a point further inside than
+// the best found so far (Agafonkin, "polylabel").
+func poleOfInaccessibility(polygon Polygon, precision float64) Point {
+	bb := polygon.Exterior().Bbox()
+	width, height := bb.Width(), bb.Height()
+	size := math.Min(width, height)
+	if size == 0 {
+		return Centroid(polygon)
+	}
+	if precision <= 0 {
+		precision = size / 100
+	}
+
+	newCell := func(x, y, h float64) *labelCell {
+		c := &labelCell{x: x, y: y, h: h}
+		c.d = distanceToPolygon(Point{x, y}, polygon)
+		c.max = c.d + h*math.Sqrt2
+		return c
+	}
+	var queue labelQueue
+	h := size / 2
+	for x := bb.MinX; x < bb.MaxX; x += size {
+		for y := bb.MinY; y < bb.MaxY; y += size {
+			heap.Push(&queue, newCell(x+h, y+h, h))
+		}
+	}
+
+	center := bb.Center()
+	best := newCell(center[0], center[1], 0)
+	if c := Centroid(polygon); !math.IsNaN(c[0]) {
+		if cell := newCell(c[0], c[1], 0); cell.d > best.d {
+			best = cell
+		}
+	}
+	for queue.Len() > 0 {
+		cell := heap.Pop(&queue).(*labelCell)
+		if cell.d > best.d {
+			best = cell
+		}
+		if cell.max-best.d <= precision {
+			continue
+		}
+		h := cell.h / 2
+		heap.Push(&queue, newCell(cell.x-h, cell.y-h, h))
+		heap.Push(&queue, newCell(cell.x+h, cell.y-h, h))
+		heap.Push(&queue, newCell(cell.x-h, cell.y+h, h))
+		heap.Push(&queue, newCell(cell.x+h, cell.y+h, h))
+	}
+	return Point{best.x, best.y}
+}
+
+// distanceToPolygon is the distance from p to the nearest ring of the
+// polygon, negative when p is outside it.
+func distanceToPolygon(p Point, polygon Polygon) float64 {
+	min := math.Inf(1)
+	for _, ring := range polygon {
+		for i := range ring {
+			a, b := ring[i], ring[(i+1)%len(ring)]
+			min = math.Min(min, distanceToSegment(p, a, b))
+		}
+	}
+	if locatePolygon(p, polygon) == Exterior {
+		return -min
+	}
+	return min
+}
+
+type labelCell struct {
+	x, y, h float64
+	// d is the distance from the centre of the cell to the polygon,
+	// and max the furthest any point in the cell could be
+	d, max float64
+}
+
+type labelQueue []*labelCell
+
+func (q labelQueue) Len() int            { return len(q) }
+func (q labelQueue) Less(i, j int) bool  { return q[i].max > q[j].max }
+func (q labelQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *labelQueue) Push(x interface{}) { *q = append(*q, x.(*labelCell)) }
+
+func (q *labelQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestAreaAndLength(t *testing.T) {
+	cases := []struct {
+		wkt          string
+		area, length float64
+	}{
+		{"POINT (1 1)", 0, 0},
+		{"LINESTRING (0 0, 3 4, 3 0)", 0, 9},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0))", 100, 40},
+		{"POLYGON ((0 0, 0 10, 10 10, 10 0, 0 0))", 100, 40},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 6 4, 6 6, 4 6, 4 4))", 96, 48},
+		{"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 1, 0 0)), ((5 5, 7 5, 7 7, 5 7, 5 5)))", 5, 12},
+	}
+	for _, c := range cases {
+		g := mustWKT(t, c.wkt)
+		if area := Area(g); !near(area, c.area, 1e-9) {
+			t.Errorf("area of %s: expected %v, got %v", c.wkt, c.area, area)
+		}
+		if length := Length(g); !near(length, c.length, 1e-9) {
+			t.Errorf("length of %s: expected %v, got %v", c.wkt, c.length, length)
+		}
+	}
+}
+
+func TestGeodesic(t *testing.T) {
+	d := math.Pi / 180
+	// one degree along the equator, and the one degree cell above it
+	equator := Coordinates{{0, 0}, {d, 0}}
+	if length := GeodesicLength(equator); !near(length, 111319.49, 0.01) {
+		t.Errorf("expected a degree of the equator to be 111319.49m, got %v", length)
+	}
+	cell := Polygon{{{0, 0}, {d, 0}, {d, d}, {0, d}, {0, 0}}}
+	if area := GeodesicArea(cell); !near(area, 12391399902, 1e3) {
+		t.Errorf("expected the cell to be 12391.4km², got %v", area/1e6)
+	}
+	meridian := Coordinates{{0, -math.Pi / 2}, {0, math.Pi / 2}}
+	if length := GeodesicLength(meridian); !near(length, math.Pi*EarthRadius, 1e-6) {
+		t.Errorf("expected pole to pole to be half the circumference, got %v", length)
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	cases := []struct {
+		wkt      string
+		expected Point
+	}{
+		{"POINT (1 2)", Point{1, 2}},
+		{"MULTIPOINT ((0 0), (2 0), (1 3))", Point{1, 1}},
+		{"LINESTRING (0 0, 10 0, 10 10)", Point{7.5, 2.5}},
+		{"POLYGON ((0 0, 4 0, 4 2, 0 2, 0 0))", Point{2, 1}},
+		{"POLYGON ((0 0, 0 2, 4 2, 4 0, 0 0))", Point{2, 1}},
+		{"POLYGON ((0 0, 4 0, 4 4, 0 4, 0 0), (0 0, 2 0, 2 4, 0 4, 0 0))", Point{3, 2}},
+		{"GEOMETRYCOLLECTION (POINT (100 100), POLYGON ((0 0, 2 0, 2 2, 0 2, 0 0)))", Point{1, 1}},
+	}
+	for _, c := range cases {
+		p := Centroid(mustWKT(t, c.wkt))
+		if !near(p[0], c.expected[0], 1e-9) || !near(p[1], c.expected[1], 1e-9) {
+			t.Errorf("centroid of %s: expected %v, got %v", c.wkt, c.expected, p)
+		}
+	}
+	if p := Centroid(MultiPoint{}); !math.IsNaN(p[0]) {
+		t.Errorf("expected the centroid of nothing to be NaN, got %v", p)
+	}
+}
+
+func TestLabelPoint(t *testing.T) {
+	// a C shape, whose centroid and bbox centre are both in the gap
+	c := mustWKT(t, "POLYGON ((0 0, 10 0, 10 2, 2 2, 2 8, 10 8, 10 10, 0 10, 0 0))")
+	if centroid := Centroid(c); Locate(centroid, c) != Exterior {
+		t.Fatalf("expected the centroid of the C to be outside it, got %v", centroid)
+	}
+	p := LabelPoint(c, 0.01)
+	if Locate(p, c) != Interior {
+		t.Fatalf("expected the label point to be inside the C, got %v", p)
+	}
+	// the thickest part is the spine, one unit from either side
+	if d := distanceToPolygon(p, c.(Polygon)); d < 0.99 {
+		t.Errorf("expected the label point to be a unit from the edge, got %v at %v", d, p)
+	}
+
+	// a big square with a hole in the middle
+	holed := mustWKT(t, "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 8 2, 8 8, 2 8, 2 2))")
+	if p := LabelPoint(holed, 0.01); Locate(p, holed) != Interior {
+		t.Errorf("expected the label point to be outside the hole, got %v", p)
+	}
+
+	// the largest polygon wins
+	multi := mustWKT(t, "MULTIPOLYGON (((0 0, 1 0, 1 1, 0 1, 0 0)), ((5 5, 9 5, 9 9, 5 9, 5 5)))")
+	if p := LabelPoint(multi, 0.01); !near(p[0], 7, 0.01) || !near(p[1], 7, 0.01) {
+		t.Errorf("expected the label point to be the middle of the larger square, got %v", p)
+	}
+
+	line := mustWKT(t, "LINESTRING (0 0, 10 0)")
+	if p := LabelPoint(line, 1); p != (Point{5, 0}) {
+		t.Errorf("expected lines to be labelled at their centroid, got %v", p)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+)
+
+// signedArea is the shoelace sum of a ring.  It is positive for rings
+// that wind counter-clockwise with the y axis pointing up.
+func signedArea(ring Coordinates) float64 {
+	var sum float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		sum += ring[i][0]*ring[j][1] - ring[j][0]*ring[i][1]
+	}
+	return sum / 2
+}
+
+// IsClockwise reports whether the ring winds clockwise with the y axis
+// pointing up, which is how shapefiles mark exterior rings.
+func (ring Coordinates) IsClockwise() bool {
+	return signedArea(ring) < 0
+}
+
+// Encloses reports whether p is inside the ring or on it.
+func (ring Coordinates) Encloses(p Point) bool {
+	return locateRing(p, ring) != Exterior
+}
+
+// AssemblePolygons groups rings into polygons using their winding:
+// clockwise rings are exteriors and counter-clockwise rings are holes.
+// Each hole goes to the smallest exterior that encloses it.  A hole
+// that no exterior encloses is kept as a polygon of its own.
+func AssemblePolygons(rings Multiline) MultiPolygon {
+	return assemble(rings, Coordinates.IsClockwise)
+}
+
+// assemble groups rings into polygons, using isExterior to tell the
+// exteriors from the holes.
+func assemble(rings []Coordinates, isExterior func(Coordinates) bool) MultiPolygon {
+	var polygons MultiPolygon
+	var holes []Coordinates
+	for _, ring := range rings {
+		if len(ring) < 3 {
+			continue
+		}
+		if isExterior(ring) {
+			polygons = append(polygons, Polygon{ring})
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+	for _, hole := range holes {
+		best, bestArea := -1, 0.0
+		for i, polygon := range polygons {
+			exterior := polygon.Exterior()
+			area := math.Abs(signedArea(exterior))
+			if exterior.Encloses(hole[0]) && (best < 0 || area < bestArea) {
+				best, bestArea = i, area
+			}
+		}
+		if best < 0 {
+			polygons = append(polygons, Polygon{hole})
+		} else {
+			polygons[best] = append(polygons[best], hole)
+		}
+	}
+	return polygons
+}
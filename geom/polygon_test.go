@@ -0,0 +1,29 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"testing"
+)
+
+func TestAssemblePolygons(t *testing.T) {
+	outer := Coordinates{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	hole := Coordinates{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}
+	island := Coordinates{{20, 0}, {20, 5}, {25, 5}, {25, 0}, {20, 0}}
+
+	if !outer.IsClockwise() || hole.IsClockwise() {
+		t.Fatal("wrong ring orientation")
+	}
+	polygons := AssemblePolygons(Multiline{outer, island, hole})
+	if len(polygons) != 2 {
+		t.Fatalf("expected 2 polygons, got %d", len(polygons))
+	}
+	if len(polygons[0].Interiors()) != 1 {
+		t.Error("the hole should belong to the first polygon")
+	}
+	if len(polygons[1].Interiors()) != 0 {
+		t.Error("the island should not have any holes")
+	}
+}
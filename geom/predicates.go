@@ -0,0 +1,463 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"sort"
+)
+
+// Location is where a point lies relative to a geometry.
+type Location int
+
+const (
+	Exterior Location = iota
+	Boundary
+	Interior
+)
+
+// Locate finds where p lies relative to g.  The ends of an open line
+// are its boundary, as are the rings of a polygon.  Points inside a
+// hole are outside the polygon.
+func Locate(p Point, g Geometry) Location {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return Locate(p, g.Geometry)
+	case Point:
+		if p == g {
+			return Interior
+		}
+	case MultiPoint:
+		for _, q := range g {
+			if p == q {
+				return Interior
+			}
+		}
+	case Coordinates:
+		return locateLine(p, g)
+	case Multiline:
+		loc := Exterior
+		for _, line := range g {
+			if l := locateLine(p, line); l > loc {
+				loc = l
+			}
+		}
+		return loc
+	case Polygon:
+		return locatePolygon(p, g)
+	case MultiPolygon:
+		loc := Exterior
+		for _, polygon := range g {
+			if l := locatePolygon(p, polygon); l > loc {
+				loc = l
+			}
+		}
+		return loc
+	case GeometryCollection:
+		loc := Exterior
+		for _, member := range g {
+			if l := Locate(p, member); l > loc {
+				loc = l
+			}
+		}
+		return loc
+	}
+	return Exterior
+}
+
+// PointInPolygon reports whether p is inside the polygon or on its
+// boundary.
+func PointInPolygon(p Point, polygon Polygon) bool {
+	return locatePolygon(p, polygon) != Exterior
+}
+
+func locateLine(p Point, line Coordinates) Location {
+	if len(line) == 0 {
+		return Exterior
+	}
+	if len(line) == 1 {
+		if p == line[0] {
+			return Interior
+		}
+		return Exterior
+	}
+	if line[0] != line[len(line)-1] && (p == line[0] || p == line[len(line)-1]) {
+		return Boundary
+	}
+	for i := 0; i+1 < len(line); i++ {
+		if orient(line[i], line[i+1], p) == 0 && onSegment(line[i], line[i+1], p) {
+			return Interior
+		}
+	}
+	return Exterior
+}
+
+func locatePolygon(p Point, polygon Polygon) Location {
+	if len(polygon) == 0 {
+		return Exterior
+	}
+	if loc := locateRing(p, polygon.Exterior()); loc != Interior {
+		return loc
+	}
+	for _, hole := range polygon.Interiors() {
+		switch locateRing(p, hole) {
+		case Boundary:
+			return Boundary
+		case Interior:
+			return Exterior
+		}
+	}
+	return Interior
+}
+
+// locateRing uses the winding number of the ring around p, so it only
+// depends on exact orientation tests and never on rounded
+// intersections.
+func locateRing(p Point, ring Coordinates) Location {
+	winding := 0
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		o := orient(a, b, p)
+		if o == 0 && onSegment(a, b, p) {
+			return Boundary
+		}
+		if a[1] <= p[1] {
+			if b[1] > p[1] && o > 0 {
+				winding++
+			}
+		} else if b[1] <= p[1] && o < 0 {
+			winding--
+		}
+	}
+	if winding != 0 {
+		return Interior
+	}
+	return Exterior
+}
+
+// Intersects reports whether a and b share at least one point.  The
+// edges are swept from left to right, so only those that overlap are
+// compared.
+func Intersects(a, b Geometry) bool {
+	if isEmpty(a) || isEmpty(b) || !a.Bbox().Intersects(b.Bbox()) {
+		return false
+	}
+	la, lb := linesOf(a), linesOf(b)
+	lines := make([]Coordinates, 0, len(la)+len(lb))
+	lines = append(append(lines, la...), lb...)
+	if sweepRings(lines, func(s, other ringSegment) bool {
+		return (s.ring < len(la)) != (other.ring < len(la)) && segmentsIntersect(s.a, s.b, other.a, other.b)
+	}) {
+		return true
+	}
+	// the boundaries don't meet, so each part of one is either wholly
+	// inside the other or wholly outside it
+	for _, p := range partVertices(a) {
+		if Locate(p, b) != Exterior {
+			return true
+		}
+	}
+	for _, p := range partVertices(b) {
+		if Locate(p, a) != Exterior {
+			return true
+		}
+	}
+	return false
+}
+
+// Disjoint reports whether a and b have no points in common.
+func Disjoint(a, b Geometry) bool {
+	return !Intersects(a, b)
+}
+
+// Contains reports whether every point of b is in a, and at least one
+// point of the interior of b is in the interior of a.  So a polygon
+// does not contain its own boundary, nor a point on it.
+func Contains(a, b Geometry) bool {
+	if isEmpty(a) || isEmpty(b) || !a.Bbox().Contains(b.Bbox()) {
+		return false
+	}
+	interior := false
+	for _, p := range testPoints(b, a) {
+		switch Locate(p, a) {
+		case Exterior:
+			return false
+		case Interior:
+			interior = true
+		}
+	}
+	// points along the boundary of a polygon say nothing about what
+	// its interior covers, so check a point inside it, and check that
+	// it doesn't swallow any of the holes of a
+	for _, polygon := range polygonsOf(b) {
+		if p, ok := interiorPoint(polygon); ok {
+			switch Locate(p, a) {
+			case Exterior:
+				return false
+			case Interior:
+				interior = true
+			}
+		}
+		for _, other := range polygonsOf(a) {
+			for _, hole := range other.Interiors() {
+				if p, ok := interiorPoint(Polygon{hole}); ok && locatePolygon(p, polygon) == Interior {
+					return false
+				}
+			}
+		}
+	}
+	return interior
+}
+
+// Within reports whether a is contained by b.
+func Within(a, b Geometry) bool {
+	return Contains(b, a)
+}
+
+func isEmpty(g Geometry) bool {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return isEmpty(g.Geometry)
+	case Point:
+		return math.IsNaN(g[0]) && math.IsNaN(g[1])
+	case Coordinates:
+		return len(g) == 0
+	case MultiPoint:
+		for _, p := range g {
+			if !isEmpty(p) {
+				return false
+			}
+		}
+	case Multiline:
+		for _, line := range g {
+			if len(line) > 0 {
+				return false
+			}
+		}
+	case Polygon:
+		return len(g) == 0 || len(g[0]) == 0
+	case MultiPolygon:
+		for _, polygon := range g {
+			if !isEmpty(polygon) {
+				return false
+			}
+		}
+	case GeometryCollection:
+		for _, member := range g {
+			if !isEmpty(member) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// linesOf lists the lines and rings of g.
+func linesOf(g Geometry) []Coordinates {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return linesOf(g.Geometry)
+	case Coordinates:
+		return []Coordinates{g}
+	case Multiline:
+		return g
+	case Polygon:
+		return g
+	case MultiPolygon:
+		var lines []Coordinates
+		for _, polygon := range g {
+			lines = append(lines, polygon...)
+		}
+		return lines
+	case GeometryCollection:
+		var lines []Coordinates
+		for _, member := range g {
+			lines = append(lines, linesOf(member)...)
+		}
+		return lines
+	}
+	return nil
+}
+
+// segmentsOf lists every edge of the lines and rings of g.
+func segmentsOf(g Geometry) [][2]Point {
+	var segments [][2]Point
+	for _, line := range linesOf(g) {
+		for i := 0; i+1 < len(line); i++ {
+			segments = append(segments, [2]Point{line[i], line[i+1]})
+		}
+	}
+	return segments
+}
+
+// partVertices lists a vertex of every line and ring of g, and all of
+// its points.
+func partVertices(g Geometry) []Point {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return partVertices(g.Geometry)
+	case Point, MultiPoint:
+		return verticesOf(g)
+	case GeometryCollection:
+		var points []Point
+		for _, member := range g {
+			points = append(points, partVertices(member)...)
+		}
+		return points
+	}
+	var points []Point
+	for _, line := range linesOf(g) {
+		if len(line) > 0 {
+			points = append(points, line[0])
+		}
+	}
+	return points
+}
+
+func verticesOf(g Geometry) []Point {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return verticesOf(g.Geometry)
+	case Point:
+		if !isEmpty(g) {
+			return []Point{g}
+		}
+	case MultiPoint:
+		var points []Point
+		for _, p := range g {
+			if !isEmpty(p) {
+				points = append(points, p)
+			}
+		}
+		return points
+	case GeometryCollection:
+		var points []Point
+		for _, member := range g {
+			points = append(points, verticesOf(member)...)
+		}
+		return points
+	}
+	var points []Point
+	for _, s := range segmentsOf(g) {
+		points = append(points, s[0], s[1])
+	}
+	if line, ok := g.(Coordinates); ok && len(line) == 1 {
+		points = append(points, line[0])
+	}
+	return points
+}
+
+func polygonsOf(g Geometry) []Polygon {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return polygonsOf(g.Geometry)
+	case Polygon:
+		return []Polygon{g}
+	case MultiPolygon:
+		return g
+	case GeometryCollection:
+		var polygons []Polygon
+		for _, member := range g {
+			polygons = append(polygons, polygonsOf(member)...)
+		}
+		return polygons
+	}
+	return nil
+}
+
+// testPoints lists the vertices of g, along with the middle of every
+// piece of its edges once they are cut where they meet the edges of
+// other.  If each of those points is in other, then so is all of g.
+func testPoints(g, other Geometry) []Point {
+	points := verticesOf(g)
+	edges := segmentsOf(other)
+	for _, s := range segmentsOf(g) {
+		cuts := []float64{0, 1}
+		for _, e := range edges {
+			cuts = append(cuts, crossings(s[0], s[1], e[0], e[1])...)
+		}
+		sort.Float64s(cuts)
+		for i := 0; i+1 < len(cuts); i++ {
+			if cuts[i] < cuts[i+1] {
+				points = append(points, interpolate(s[0], s[1], (cuts[i]+cuts[i+1])/2))
+			}
+		}
+	}
+	return points
+}
+
+// crossings returns where along ab, as fractions of its length, the
+// segment cd meets it.
+func crossings(a, b, c, d Point) []float64 {
+	if !segmentsIntersect(a, b, c, d) {
+		return nil
+	}
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return nil
+	}
+	along := func(p Point) float64 {
+		return ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / length
+	}
+	if orient(a, b, c) == 0 && orient(a, b, d) == 0 {
+		return []float64{clamp01(along(c)), clamp01(along(d))}
+	}
+	ex, ey := d[0]-c[0], d[1]-c[1]
+	denom := dx*ey - dy*ex
+	if denom == 0 {
+		return nil
+	}
+	t := ((c[0]-a[0])*ey - (c[1]-a[1])*ex) / denom
+	return []float64{clamp01(t)}
+}
+
+func clamp01(t float64) float64 {
+	return math.Max(0, math.Min(1, t))
+}
+
+// interiorPoint finds a point strictly inside the polygon.  It draws a
+// horizontal line through the widest gap between the heights of its
+// vertices, so the line never passes through one, and takes the middle
+// of the widest stretch of it that is inside the polygon.
+func interiorPoint(polygon Polygon) (Point, bool) {
+	var ys []float64
+	for _, ring := range polygon {
+		for _, p := range ring {
+			ys = append(ys, p[1])
+		}
+	}
+	sort.Float64s(ys)
+	y, gap := 0.0, 0.0
+	for i := 0; i+1 < len(ys); i++ {
+		if d := ys[i+1] - ys[i]; d > gap {
+			y, gap = (ys[i]+ys[i+1])/2, d
+		}
+	}
+	if gap == 0 {
+		return Point{}, false
+	}
+
+	var xs []float64
+	for _, ring := range polygon {
+		for i := range ring {
+			a, b := ring[i], ring[(i+1)%len(ring)]
+			if (a[1] < y) != (b[1] < y) {
+				xs = append(xs, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+			}
+		}
+	}
+	sort.Float64s(xs)
+	best, width := 0.0, 0.0
+	for i := 0; i+1 < len(xs); i += 2 {
+		if d := xs[i+1] - xs[i]; d > width {
+			best, width = (xs[i]+xs[i+1])/2, d
+		}
+	}
+	if width == 0 {
+		return Point{}, false
+	}
+	return Point{best, y}, true
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func mustWKT(t *testing.T, s string) Geometry {
+	g, err := UnmarshalWKT(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestOrientNearlyCollinear(t *testing.T) {
+	// points a few ulps either side of the line y = x, where the
+	// plain floating point determinant often gets the sign wrong
+	b, c := Point{12, 12}, Point{24, 24}
+	exact := func(a Point) int {
+		r := func(v float64) *big.Rat { return new(big.Rat).SetFloat64(v) }
+		sub := func(x, y float64) *big.Rat { return new(big.Rat).Sub(r(x), r(y)) }
+		left := new(big.Rat).Mul(sub(b[0], a[0]), sub(c[1], a[1]))
+		right := new(big.Rat).Mul(sub(b[1], a[1]), sub(c[0], a[0]))
+		return left.Cmp(right)
+	}
+	wrong := 0
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 64; j++ {
+			a := Point{0.5 + float64(i)*math.Pow(2, -53), 0.5 + float64(j)*math.Pow(2, -53)}
+			if orient(a, b, c) != exact(a) {
+				t.Fatalf("orient(%v) = %d, expected %d", a, orient(a, b, c), exact(a))
+			}
+			if sign(orientation(a, b, c)) != exact(a) {
+				wrong++
+			}
+		}
+	}
+	if wrong == 0 {
+		t.Log("the floating point determinant happened to be right everywhere")
+	}
+	if orient(Point{0, 0}, Point{0, 0}, Point{1, 1}) != 0 {
+		t.Error("a degenerate segment is collinear with everything")
+	}
+}
+
+func TestLocate(t *testing.T) {
+	polygon := mustWKT(t, "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 6 4, 6 6, 4 6, 4 4))")
+	line := mustWKT(t, "LINESTRING (0 0, 5 5, 10 0)")
+	ring := mustWKT(t, "LINESTRING (0 0, 1 0, 1 1, 0 0)")
+	cases := []struct {
+		p        Point
+		g        Geometry
+		expected Location
+	}{
+		{Point{1, 1}, polygon, Interior},
+		{Point{5, 5}, polygon, Exterior},
+		{Point{0, 0}, polygon, Boundary},
+		{Point{5, 0}, polygon, Boundary},
+		{Point{4, 5}, polygon, Boundary},
+		{Point{10, 10}, polygon, Boundary},
+		{Point{11, 5}, polygon, Exterior},
+		{Point{-1, 0}, polygon, Exterior},
+		{Point{5, 10}, polygon, Boundary},
+		{Point{0, 0}, line, Boundary},
+		{Point{2.5, 2.5}, line, Interior},
+		{Point{5, 5}, line, Interior},
+		{Point{5, 4}, line, Exterior},
+		{Point{0, 0}, ring, Interior},
+		{Point{1, 2}, Point{1, 2}, Interior},
+		{Point{1, 2}, MultiPoint{{0, 0}, {1, 2}}, Interior},
+		{Point{1, 2}, Coordinates{}, Exterior},
+	}
+	for _, c := range cases {
+		if loc := Locate(c.p, c.g); loc != c.expected {
+			t.Errorf("%v in %s: expected %d, got %d", c.p, wkt(t, c.g), c.expected, loc)
+		}
+	}
+	if !PointInPolygon(Point{5, 0}, polygon.(Polygon)) {
+		t.Error("a point on the boundary is in the polygon")
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	square := "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0))"
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{square, "POLYGON ((10 0, 20 0, 20 10, 10 10, 10 0))", true},
+		{square, "POLYGON ((10 10, 20 10, 20 20, 10 20, 10 10))", true},
+		{square, "POLYGON ((2 2, 3 2, 3 3, 2 2))", true},
+		{square, "POLYGON ((-5 -5, 15 -5, 15 15, -5 15, -5 -5))", true},
+		{square, "POLYGON ((11 0, 20 0, 20 10, 11 0))", false},
+		{square, "POINT (10 5)", true},
+		{square, "POINT (10.000000000000002 5)", false},
+		{square, "LINESTRING (-1 5, 11 5)", true},
+		{square, "LINESTRING (-1 11, 11 11)", false},
+		{square, "LINESTRING (10 10, 11 11)", true},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 8 2, 8 8, 2 8, 2 2))", "POINT (5 5)", false},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 8 2, 8 8, 2 8, 2 2))", "POLYGON ((3 3, 4 3, 4 4, 3 3))", false},
+		{"LINESTRING (0 0, 10 10)", "LINESTRING (0 10, 10 0)", true},
+		{"LINESTRING (0 0, 10 10)", "LINESTRING (5 5, 20 20)", true},
+		{"LINESTRING (0 0, 10 10)", "LINESTRING (11 11, 20 20)", false},
+		{"LINESTRING (0 0, 10 10)", "LINESTRING (1 0, 11 10)", false},
+		{"POINT (1 1)", "POINT (1 1)", true},
+		{"POINT (1 1)", "POINT EMPTY", false},
+		{"POLYGON EMPTY", square, false},
+		{"GEOMETRYCOLLECTION (POINT (50 50), LINESTRING (5 -1, 5 1))", square, true},
+		{square, "POINT Z (5 5 1)", true},
+		{square, "LINESTRING M (20 20 1, 30 30 2)", false},
+		{"POLYGON Z ((0 0 1, 10 0 1, 10 10 1, 0 0 1))", "POINT (6 5)", true},
+	}
+	for _, c := range cases {
+		a, b := mustWKT(t, c.a), mustWKT(t, c.b)
+		if got := Intersects(a, b); got != c.expected {
+			t.Errorf("Intersects(%s, %s): expected %v", c.a, c.b, c.expected)
+		}
+		if got := Intersects(b, a); got != c.expected {
+			t.Errorf("Intersects(%s, %s): expected %v", c.b, c.a, c.expected)
+		}
+		if got := Disjoint(a, b); got == c.expected {
+			t.Errorf("Disjoint(%s, %s): expected %v", c.a, c.b, !c.expected)
+		}
+	}
+
+	// big rings are swept rather than compared edge by edge, which
+	// would take seconds here
+	circle := func(r float64) Coordinates {
+		const n = 20000
+		ring := make(Coordinates, n+1)
+		for i := range ring {
+			angle := 2 * math.Pi * float64(i%n) / n
+			ring[i] = Point{r * math.Cos(angle), r * math.Sin(angle)}
+		}
+		return ring
+	}
+	annulus := Polygon{circle(10), reversed(circle(5))}
+	if Intersects(annulus, Polygon{circle(2)}) {
+		t.Error("expected a polygon in the hole not to intersect")
+	}
+	if !Intersects(annulus, Polygon{circle(7)}) {
+		t.Error("expected a polygon across the hole to intersect")
+	}
+}
+
+func TestContains(t *testing.T) {
+	square := "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0))"
+	holed := "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 6 4, 6 6, 4 6, 4 4))"
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{square, "POINT (5 5)", true},
+		{square, "POINT (10 5)", false},
+		{square, "POINT (11 5)", false},
+		{square, square, true},
+		{square, "POLYGON ((0 0, 5 0, 5 5, 0 5, 0 0))", true},
+		{square, "POLYGON ((5 5, 15 5, 15 15, 5 15, 5 5))", false},
+		{square, "LINESTRING (1 1, 9 9)", true},
+		{square, "LINESTRING (0 0, 10 0)", false},
+		{square, "LINESTRING (0 0, 5 5)", true},
+		{square, "LINESTRING (5 5, 15 5)", false},
+		{"POLYGON ((0 0, 10 0, 10 10, 5 5, 0 10, 0 0))", "LINESTRING (1 9, 9 9)", false},
+		{holed, "POINT (5 5)", false},
+		{holed, "POINT (2 2)", true},
+		{holed, "LINESTRING (1 5, 9 5)", false},
+		{holed, "POLYGON ((1 1, 9 1, 9 9, 1 9, 1 1))", false},
+		{holed, "POLYGON ((1 1, 3 1, 3 3, 1 3, 1 1))", true},
+		{holed, "POLYGON ((1 1, 9 1, 9 9, 1 9, 1 1), (3 3, 7 3, 7 7, 3 7, 3 3))", true},
+		{"LINESTRING (0 0, 10 10)", "LINESTRING (2 2, 5 5)", true},
+		{"LINESTRING (0 0, 10 10)", "POINT (0 0)", false},
+		{"LINESTRING (0 0, 10 10)", "POINT (3 3)", true},
+		{"MULTIPOINT ((1 1), (2 2))", "POINT (2 2)", true},
+		{square, "POLYGON EMPTY", false},
+		{square, "POINT Z (5 5 1)", true},
+		{"POLYGON ZM ((0 0 1 2, 10 0 1 2, 10 10 1 2, 0 10 1 2, 0 0 1 2))", "LINESTRING (1 1, 9 9)", true},
+	}
+	for _, c := range cases {
+		a, b := mustWKT(t, c.a), mustWKT(t, c.b)
+		if got := Contains(a, b); got != c.expected {
+			t.Errorf("Contains(%s, %s): expected %v", c.a, c.b, c.expected)
+		}
+		if got := Within(b, a); got != c.expected {
+			t.Errorf("Within(%s, %s): expected %v", c.b, c.a, c.expected)
+		}
+	}
+}
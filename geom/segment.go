@@ -0,0 +1,180 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// orientation is positive if c is to the left of the line from a to b,
+// negative if it is to the right, and zero if the three are collinear.
+// It is twice the signed area of the triangle abc, but its sign can be
+// wrong when the points are very nearly collinear; use orient for that.
+func orientation(a, b, c Point) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// orientErrBound bounds the rounding error of orientation relative to
+// the magnitude of its terms (Shewchuk, "Adaptive Precision
+// Floating-Point Arithmetic and Fast Robust Geometric Predicates").
+var orientErrBound = (3 + 16*epsilon) * epsilon
+
+const epsilon = 1.0 / (1 << 53)
+
+// orient is the sign of orientation, computed exactly.  The floating
+// point result is used whenever it is far enough from zero to be
+// trusted, and exact rational arithmetic otherwise.
+func orient(a, b, c Point) int {
+	left := (b[0] - a[0]) * (c[1] - a[1])
+	right := (b[1] - a[1]) * (c[0] - a[0])
+	det := left - right
+	if math.Abs(det) >= orientErrBound*(math.Abs(left)+math.Abs(right)) {
+		return sign(det)
+	}
+	return exactOrient(a, b, c)
+}
+
+func exactOrient(a, b, c Point) int {
+	for _, v := range [6]float64{a[0], a[1], b[0], b[1], c[0], c[1]} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0
+		}
+	}
+	r := func(v float64) *big.Rat { return new(big.Rat).SetFloat64(v) }
+	sub := func(x, y float64) *big.Rat { return new(big.Rat).Sub(r(x), r(y)) }
+	left := new(big.Rat).Mul(sub(b[0], a[0]), sub(c[1], a[1]))
+	right := new(big.Rat).Mul(sub(b[1], a[1]), sub(c[0], a[0]))
+	return left.Cmp(right)
+}
+
+// onSegment reports whether c, known to be collinear with a and b, lies
+// between them.
+func onSegment(a, b, c Point) bool {
+	return math.Min(a[0], b[0]) <= c[0] && c[0] <= math.Max(a[0], b[0]) &&
+		math.Min(a[1], b[1]) <= c[1] && c[1] <= math.Max(a[1], b[1])
+}
+
+func sign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// segmentsIntersect reports whether the segments ab and cd share any
+// point, including touching at an end or overlapping along a line.
+func segmentsIntersect(a, b, c, d Point) bool {
+	d1 := orient(c, d, a)
+	d2 := orient(c, d, b)
+	d3 := orient(a, b, c)
+	d4 := orient(a, b, d)
+	if d1*d2 < 0 && d3*d4 < 0 {
+		return true
+	}
+	return d1 == 0 && onSegment(c, d, a) ||
+		d2 == 0 && onSegment(c, d, b) ||
+		d3 == 0 && onSegment(a, b, c) ||
+		d4 == 0 && onSegment(a, b, d)
+}
+
+// segmentsOverlap reports whether the segments ab and cd cross at a
+// point inside both of them, or run along each other for some length.
+// Unlike segmentsIntersect, touching is not enough.
+func segmentsOverlap(a, b, c, d Point) bool {
+	d1 := orient(c, d, a)
+	d2 := orient(c, d, b)
+	d3 := orient(a, b, c)
+	d4 := orient(a, b, d)
+	if d1*d2 < 0 && d3*d4 < 0 {
+		return true
+	}
+	if d1 != 0 || d2 != 0 || d3 != 0 || d4 != 0 {
+		return false
+	}
+	axis := 0
+	if math.Abs(b[1]-a[1])+math.Abs(d[1]-c[1]) > math.Abs(b[0]-a[0])+math.Abs(d[0]-c[0]) {
+		axis = 1
+	}
+	lo := math.Max(math.Min(a[axis], b[axis]), math.Min(c[axis], d[axis]))
+	hi := math.Min(math.Max(a[axis], b[axis]), math.Max(c[axis], d[axis]))
+	return lo < hi
+}
+
+// distanceToSegment is the distance from p to the closest point of the
+// segment ab.
+func distanceToSegment(p, a, b Point) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+type ringSegment struct {
+	a, b       Point
+	ring, edge int
+}
+
+// ringsCross reports whether any two edges of the rings intersect,
+// other than neighbouring edges of the same ring meeting at their
+// shared vertex.
+func ringsCross(rings []Coordinates) bool {
+	return sweepRings(rings, func(s, other ringSegment) bool {
+		if s.ring == other.ring && adjacentEdges(s.edge, other.edge, len(rings[s.ring])-1) {
+			return false
+		}
+		return segmentsIntersect(s.a, s.b, other.a, other.b)
+	})
+}
+
+// sweepRings reports whether meet holds for any two edges of the rings.
+// The edges are swept from left to right, so only those that overlap
+// in x are compared.
+func sweepRings(rings []Coordinates, meet func(s, other ringSegment) bool) bool {
+	var segments []ringSegment
+	for r, ring := range rings {
+		for i := 0; i+1 < len(ring); i++ {
+			segments = append(segments, ringSegment{ring[i], ring[i+1], r, i})
+		}
+	}
+	minX := func(s ringSegment) float64 { return math.Min(s.a[0], s.b[0]) }
+	maxX := func(s ringSegment) float64 { return math.Max(s.a[0], s.b[0]) }
+	sort.Slice(segments, func(i, j int) bool { return minX(segments[i]) < minX(segments[j]) })
+
+	var active []ringSegment
+	for _, s := range segments {
+		kept := active[:0]
+		for _, other := range active {
+			if maxX(other) >= minX(s) {
+				kept = append(kept, other)
+			}
+		}
+		active = kept
+		for _, other := range active {
+			if meet(s, other) {
+				return true
+			}
+		}
+		active = append(active, s)
+	}
+	return false
+}
+
+// adjacentEdges reports whether edges i and j of a closed ring with n
+// edges share a vertex.
+func adjacentEdges(i, j, n int) bool {
+	d := i - j
+	if d < 0 {
+		d = -d
+	}
+	return d == 1 || d == n-1
+}
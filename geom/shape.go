@@ -9,6 +9,38 @@ type Shape interface {
 	Attribute(string) string
 }
 
+// AttributedShape is implemented by shapes that can list all of their
+// attributes.
+type AttributedShape interface {
+	Shape
+	Attributes() map[string]string
+}
+
+// LookupShape is implemented by shapes that can tell an attribute that
+// is empty from one that they don't have.
+type LookupShape interface {
+	Shape
+	LookupAttribute(string) (string, bool)
+}
+
+// LookupAttribute looks an attribute of a shape up, and reports whether
+// the shape has it.  Shapes that list their attributes have those, and
+// their Z and M values; other shapes are taken to have the attributes
+// that aren't empty.
+func LookupAttribute(shape Shape, name string) (string, bool) {
+	switch s := shape.(type) {
+	case LookupShape:
+		return s.LookupAttribute(name)
+	case AttributedShape:
+		if v, ok := s.Attributes()[name]; ok {
+			return v, true
+		}
+		return ZMAttribute(shape, name)
+	}
+	v := shape.Attribute(name)
+	return v, v != ""
+}
+
 type PointShape interface {
 	Shape
 	Point() Point
@@ -24,7 +56,40 @@ type MultiLineShape interface {
 	Paths() Multiline
 }
 
+type MultiPointShape interface {
+	Shape
+	Points() MultiPoint
+}
+
+// PolygonShape is implemented by every polygonal shape.  A single
+// feature may have several disjoint parts, so the rings are always
+// grouped as a MultiPolygon.
 type PolygonShape interface {
 	Shape
-	Polygon() Multiline
+	Polygons() MultiPolygon
+}
+
+type CollectionShape interface {
+	Shape
+	Geometries() GeometryCollection
+}
+
+// GeometryOf returns the geometry of a shape, or nil if the shape is
+// not one of the shape types above.
+func GeometryOf(shape Shape) Geometry {
+	switch s := shape.(type) {
+	case PointShape:
+		return s.Point()
+	case MultiPointShape:
+		return s.Points()
+	case LineShape:
+		return s.Path()
+	case MultiLineShape:
+		return s.Paths()
+	case PolygonShape:
+		return s.Polygons()
+	case CollectionShape:
+		return s.Geometries()
+	}
+	return nil
 }
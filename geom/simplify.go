@@ -0,0 +1,217 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"container/heap"
+	"math"
+)
+
+// A Simplifier drops vertices from a line that are within tolerance of
+// it, always keeping the first and last points.
+type Simplifier func(line Coordinates, tolerance float64) Coordinates
+
+// DouglasPeucker keeps a vertex only if it is further than tolerance
+// from the segment that would replace it.
+func DouglasPeucker(line Coordinates, tolerance float64) Coordinates {
+	if len(line) < 3 || tolerance <= 0 {
+		return line
+	}
+	keep := make([]bool, len(line))
+	keep[0], keep[len(line)-1] = true, true
+	stack := [][2]int{{0, len(line) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+		furthest, max := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := distanceToSegment(line[i], line[first], line[last]); d > max {
+				furthest, max = i, d
+			}
+		}
+		if furthest >= 0 {
+			keep[furthest] = true
+			stack = append(stack, [2]int{first, furthest}, [2]int{furthest, last})
+		}
+	}
+	simplified := make(Coordinates, 0, len(line))
+	for i, p := range line {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// Visvalingam repeatedly drops the vertex whose triangle with its
+// neighbours has the least area, until every remaining triangle is at
+// least tolerance squared.
+func Visvalingam(line Coordinates, tolerance float64) Coordinates {
+	if len(line) < 3 || tolerance <= 0 {
+		return line
+	}
+	threshold := tolerance * tolerance
+	vertices := make([]*vwVertex, len(line))
+	for i := range line {
+		vertices[i] = &vwVertex{index: i, prev: i - 1, next: i + 1}
+	}
+	area := func(v *vwVertex) float64 {
+		return math.Abs(orientation(line[v.prev], line[v.index], line[v.next])) / 2
+	}
+	queue := make(vwQueue, 0, len(line)-2)
+	for _, v := range vertices[1 : len(line)-1] {
+		v.area = area(v)
+		queue = append(queue, v)
+	}
+	heap.Init(&queue)
+
+	removed := make([]bool, len(line))
+	for len(queue) > 0 && queue[0].area < threshold {
+		v := heap.Pop(&queue).(*vwVertex)
+		removed[v.index] = true
+		prev, next := vertices[v.prev], vertices[v.next]
+		prev.next, next.prev = v.next, v.prev
+		// a neighbour never gets a smaller area than the vertex just
+		// removed, so that it isn't dropped ahead of its turn
+		for _, n := range []*vwVertex{prev, next} {
+			if n.prev >= 0 && n.next < len(line) {
+				n.area = math.Max(area(n), v.area)
+				heap.Fix(&queue, n.heapIndex)
+			}
+		}
+	}
+	simplified := make(Coordinates, 0, len(line))
+	for i, p := range line {
+		if !removed[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+type vwVertex struct {
+	index, prev, next int
+	area              float64
+	heapIndex         int
+}
+
+type vwQueue []*vwVertex
+
+func (q vwQueue) Len() int           { return len(q) }
+func (q vwQueue) Less(i, j int) bool { return q[i].area < q[j].area }
+func (q vwQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].heapIndex, q[j].heapIndex = i, j
+}
+
+func (q *vwQueue) Push(x interface{}) {
+	v := x.(*vwVertex)
+	v.heapIndex = len(*q)
+	*q = append(*q, v)
+}
+
+func (q *vwQueue) Pop() interface{} {
+	old := *q
+	v := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return v
+}
+
+// Simplify simplifies every line and ring of g.  Rings are kept valid:
+// if simplifying a polygon would leave its exterior with fewer than
+// three corners, or make any of its rings cross, it is tried again with
+// a smaller tolerance, and left alone if that doesn't help.  Holes that
+// collapse are dropped, as are polygons that are smaller than the
+// tolerance altogether.
+func Simplify(g Geometry, tolerance float64, simplify Simplifier) Geometry {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return Simplify(g.Geometry, tolerance, simplify)
+	case Coordinates:
+		return simplify(g, tolerance)
+	case Multiline:
+		lines := make(Multiline, len(g))
+		for i, line := range g {
+			lines[i] = simplify(line, tolerance)
+		}
+		return lines
+	case Polygon:
+		return SimplifyPolygon(g, tolerance, simplify)
+	case MultiPolygon:
+		var polygons MultiPolygon
+		for _, polygon := range g {
+			if simplified := SimplifyPolygon(polygon, tolerance, simplify); simplified != nil {
+				polygons = append(polygons, simplified)
+			}
+		}
+		return polygons
+	case GeometryCollection:
+		gc := make(GeometryCollection, len(g))
+		for i, member := range g {
+			gc[i] = Simplify(member, tolerance, simplify)
+		}
+		return gc
+	}
+	return g
+}
+
+// simplifyAttempts is how many times the tolerance is halved while
+// looking for a valid simplification of a polygon.
+const simplifyAttempts = 4
+
+// SimplifyPolygon simplifies each ring of the polygon, as described for
+// Simplify.  It returns nil if the whole polygon collapses.
+func SimplifyPolygon(polygon Polygon, tolerance float64, simplify Simplifier) Polygon {
+	if len(polygon) == 0 || tolerance <= 0 {
+		return polygon
+	}
+	exterior := dedupe(polygon.Exterior())
+	if bb := exterior.Bbox(); bb.Width() < tolerance && bb.Height() < tolerance {
+		return nil
+	}
+	for attempt := 0; attempt < simplifyAttempts; attempt++ {
+		simplified := Polygon{simplify(exterior, tolerance)}
+		if validRing(simplified[0], exterior) {
+			for _, hole := range polygon.Interiors() {
+				hole = dedupe(hole)
+				if ring := simplify(hole, tolerance); validRing(ring, hole) {
+					simplified = append(simplified, ring)
+				}
+			}
+			if !ringsCross(simplified) {
+				return simplified
+			}
+		}
+		tolerance /= 2
+	}
+	return polygon
+}
+
+// validRing reports whether a simplified ring is still closed, still
+// encloses some area, and still winds the same way as the original.
+func validRing(ring, original Coordinates) bool {
+	if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+		return false
+	}
+	area := signedArea(ring)
+	return area != 0 && (area > 0) == (signedArea(original) > 0)
+}
+
+// dedupe drops consecutive repeated points.
+func dedupe(coords Coordinates) Coordinates {
+	for i := 1; i < len(coords); i++ {
+		if coords[i] == coords[i-1] {
+			deduped := append(Coordinates(nil), coords[:i]...)
+			for _, p := range coords[i:] {
+				if p != deduped[len(deduped)-1] {
+					deduped = append(deduped, p)
+				}
+			}
+			return deduped
+		}
+	}
+	return coords
+}
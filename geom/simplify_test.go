@@ -0,0 +1,81 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"testing"
+)
+
+func TestDouglasPeucker(t *testing.T) {
+	line := Coordinates{{0, 0}, {1, 0.1}, {2, -0.1}, {3, 5}, {4, 6}, {5, 7}, {6, 8.1}, {7, 9}, {8, 9}, {9, 9}}
+	expected := "LINESTRING (0 0, 2 -0.1, 3 5, 7 9, 9 9)"
+	if out := wkt(t, DouglasPeucker(line, 0.5)); out != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+	if out := DouglasPeucker(line, 0); len(out) != len(line) {
+		t.Error("a zero tolerance should keep every point")
+	}
+}
+
+func TestVisvalingam(t *testing.T) {
+	line := Coordinates{{0, 0}, {1, 0.1}, {2, -0.1}, {3, 5}, {4, 6}, {5, 7}, {6, 8.1}, {7, 9}, {8, 9}, {9, 9}}
+	expected := "LINESTRING (0 0, 2 -0.1, 3 5, 7 9, 9 9)"
+	if out := wkt(t, Visvalingam(line, 1)); out != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+	if out := wkt(t, Visvalingam(line, 100)); out != "LINESTRING (0 0, 9 9)" {
+		t.Errorf("expected only the end points, got %s", out)
+	}
+}
+
+func TestSimplifyPolygon(t *testing.T) {
+	for name, simplify := range map[string]Simplifier{"dp": DouglasPeucker, "vw": Visvalingam} {
+		// a square with a low bump, and a hole that reaches up into the
+		// bump: flattening the bump at full tolerance would make the
+		// exterior cross the hole
+		g, _ := UnmarshalWKT("POLYGON ((0 0, 0 10, 3 10, 5 11.5, 7 10, 10 10, 10 0, 0 0), (2 2, 8 2, 8 8, 5 11, 2 8, 2 2))")
+		polygon := Simplify(g, 2, simplify).(Polygon)
+		if len(polygon) != 2 {
+			t.Errorf("%s: expected the hole to be kept, got %s", name, wkt(t, polygon))
+			continue
+		}
+		if ringsCross(polygon) {
+			t.Errorf("%s: rings cross in %s", name, wkt(t, polygon))
+		}
+		if !validRing(polygon[0], g.(Polygon)[0]) {
+			t.Errorf("%s: invalid exterior in %s", name, wkt(t, polygon))
+		}
+
+		// an island smaller than the tolerance disappears
+		islands := MultiPolygon{
+			Polygon{{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}},
+			Polygon{{{20, 20}, {20, 21}, {21, 21}, {21, 20}, {20, 20}}},
+		}
+		if out := Simplify(islands, 2, simplify).(MultiPolygon); len(out) != 1 {
+			t.Errorf("%s: expected the island to be dropped, got %s", name, wkt(t, out))
+		}
+
+		// a thin ring never drops below three corners
+		sliver := Polygon{{{0, 0}, {5, 0.5}, {10, 0}, {10, 3}, {0, 3}, {0, 0}}}
+		if out := Simplify(sliver, 4, simplify).(Polygon); !validRing(out[0], sliver[0]) {
+			t.Errorf("%s: invalid ring %s", name, wkt(t, out))
+		}
+	}
+}
+
+func TestRingsCross(t *testing.T) {
+	bowtie := Coordinates{{0, 0}, {10, 10}, {10, 0}, {0, 10}, {0, 0}}
+	if !ringsCross([]Coordinates{bowtie}) {
+		t.Error("a bowtie crosses itself")
+	}
+	square := Coordinates{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	if ringsCross([]Coordinates{square}) {
+		t.Error("a square doesn't cross itself")
+	}
+	hole := Coordinates{{5, 5}, {15, 5}, {15, 6}, {5, 5}}
+	if !ringsCross([]Coordinates{square, hole}) {
+		t.Error("the hole crosses the exterior")
+	}
+}
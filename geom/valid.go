@@ -0,0 +1,293 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	ErrNonFinite        = errors.New("Non-Finite Coordinate")
+	ErrTooFewPoints     = errors.New("Too Few Points")
+	ErrRepeatedPoint    = errors.New("Repeated Point")
+	ErrUnclosedRing     = errors.New("Unclosed Ring")
+	ErrSelfIntersection = errors.New("Self Intersection")
+	ErrHoleOutside      = errors.New("Hole Outside Shell")
+	ErrOverlap          = errors.New("Overlapping Polygons")
+)
+
+// Validate returns the first problem it finds with g, or nil if it is
+// valid.  Coordinates must be finite and lines may not repeat a point
+// twice in a row.  Rings must be closed, have at least four points,
+// and neither cross nor touch themselves.  Different rings may touch
+// at points, but not cross.  Holes must be inside their exterior and
+// apart from each other, and the polygons of a MultiPolygon may not
+// overlap.  The way rings wind is not checked; see Orient.
+func Validate(g Geometry) error {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return Validate(g.Geometry)
+	case Point:
+		if !isEmpty(g) && !finite(g) {
+			return ErrNonFinite
+		}
+	case MultiPoint:
+		for _, p := range g {
+			if err := Validate(p); err != nil {
+				return err
+			}
+		}
+	case Coordinates:
+		if len(g) < 2 {
+			return ErrTooFewPoints
+		}
+		return validateLine(g)
+	case Multiline:
+		for _, line := range g {
+			if err := Validate(line); err != nil {
+				return err
+			}
+		}
+	case Polygon:
+		return validatePolygons([]Polygon{g})
+	case MultiPolygon:
+		return validatePolygons(g)
+	case GeometryCollection:
+		for _, member := range g {
+			if err := Validate(member); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func finite(p Point) bool {
+	return !math.IsNaN(p[0]) && !math.IsNaN(p[1]) && !math.IsInf(p[0], 0) && !math.IsInf(p[1], 0)
+}
+
+func validateLine(line Coordinates) error {
+	for i, p := range line {
+		if !finite(p) {
+			return ErrNonFinite
+		}
+		if i > 0 && p == line[i-1] {
+			return ErrRepeatedPoint
+		}
+	}
+	return nil
+}
+
+func validateRing(ring Coordinates) error {
+	if err := validateLine(ring); err != nil {
+		return err
+	}
+	if len(ring) < 4 {
+		return ErrTooFewPoints
+	}
+	if ring[0] != ring[len(ring)-1] {
+		return ErrUnclosedRing
+	}
+	if signedArea(ring) == 0 || ringsCross([]Coordinates{ring}) {
+		return ErrSelfIntersection
+	}
+	return nil
+}
+
+func validatePolygons(polygons []Polygon) error {
+	var rings []Coordinates
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			if err := validateRing(ring); err != nil {
+				return err
+			}
+		}
+		rings = append(rings, polygon...)
+	}
+	// different rings may touch, but not cross or share an edge
+	if sweepRings(rings, func(s, other ringSegment) bool {
+		return s.ring != other.ring && segmentsOverlap(s.a, s.b, other.a, other.b)
+	}) {
+		return ErrSelfIntersection
+	}
+	for i, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		exterior := polygon.Exterior()
+		holes := polygon.Interiors()
+		for j, hole := range holes {
+			if anyPoint(hole, func(p Point) bool { return locateRing(p, exterior) == Exterior }) {
+				return ErrHoleOutside
+			}
+			for _, other := range holes[j+1:] {
+				if ringsOverlap(hole, other) {
+					return ErrSelfIntersection
+				}
+			}
+		}
+		for _, other := range polygons[i+1:] {
+			if len(other) == 0 || !exterior.Bbox().Intersects(other.Bbox()) {
+				continue
+			}
+			if anyPoint(other.Exterior(), func(p Point) bool { return locatePolygon(p, polygon) == Interior }) ||
+				anyPoint(exterior, func(p Point) bool { return locatePolygon(p, other) == Interior }) {
+				return ErrOverlap
+			}
+		}
+	}
+	return nil
+}
+
+// ringsOverlap reports whether the areas inside two rings that neither
+// cross nor share an edge overlap.
+func ringsOverlap(a, b Coordinates) bool {
+	return anyPoint(a, func(p Point) bool { return locateRing(p, b) == Interior }) ||
+		anyPoint(b, func(p Point) bool { return locateRing(p, a) == Interior })
+}
+
+// anyPoint reports whether f holds for a vertex of the line or the
+// middle of one of its edges.  When the line crosses no other, that is
+// enough to tell whether any of it is on a given side of the other.
+func anyPoint(line Coordinates, f func(Point) bool) bool {
+	for i, p := range line {
+		if f(p) || i > 0 && f(interpolate(line[i-1], p, 0.5)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeValid repairs g.  A geometry that is already valid is returned
+// as it is.  Otherwise points and lines lose their non-finite and
+// repeated points, and lines left with fewer than two are dropped.
+// Rings are closed, and polygons are rebuilt to cover the area inside
+// any of their exteriors, however they wind or cross themselves, and
+// outside all of their holes.  Polygons always come back as a
+// MultiPolygon, with their exteriors anticlockwise and holes clockwise.
+func MakeValid(g Geometry) Geometry {
+	if Validate(g) == nil {
+		return g
+	}
+	switch g := g.(type) {
+	case ZMGeometry:
+		return MakeValid(g.Geometry)
+	case Point:
+		if !finite(g) {
+			return Point{math.NaN(), math.NaN()}
+		}
+	case MultiPoint:
+		var points MultiPoint
+		for _, p := range g {
+			if finite(p) {
+				points = append(points, p)
+			}
+		}
+		return points
+	case Coordinates:
+		return cleanLine(g)
+	case Multiline:
+		var lines Multiline
+		for _, line := range g {
+			if line = cleanLine(line); line != nil {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	case Polygon:
+		return repairPolygons([]Polygon{g})
+	case MultiPolygon:
+		return repairPolygons(g)
+	case GeometryCollection:
+		repaired := make(GeometryCollection, len(g))
+		for i, member := range g {
+			repaired[i] = MakeValid(member)
+		}
+		return repaired
+	}
+	return g
+}
+
+// cleanLine drops the non-finite and repeated points of a line, and
+// returns nil if fewer than two are left.
+func cleanLine(line Coordinates) Coordinates {
+	var cleaned Coordinates
+	for _, p := range line {
+		if finite(p) && (len(cleaned) == 0 || p != cleaned[len(cleaned)-1]) {
+			cleaned = append(cleaned, p)
+		}
+	}
+	if len(cleaned) < 2 {
+		return nil
+	}
+	return cleaned
+}
+
+// repairPolygons traces the area covered by the polygons.  Each ring is
+// first split into the parts it winds around either way, all wound
+// positively for exteriors and negatively for holes, so that the area
+// of the polygons is exactly where they all wind positively.
+func repairPolygons(polygons []Polygon) MultiPolygon {
+	var rings []Coordinates
+	for _, polygon := range polygons {
+		for i, ring := range polygon {
+			ring = cleanLine(ring)
+			if ring != nil && ring[0] != ring[len(ring)-1] {
+				ring = append(ring, ring[0])
+			}
+			if len(ring) < 4 {
+				if i == 0 {
+					break
+				}
+				continue
+			}
+			pieces := windingBoundary([]Coordinates{ring})
+			pieces = append(pieces, windingBoundary([]Coordinates{reversed(ring)})...)
+			for _, piece := range pieces {
+				if i > 0 {
+					piece = reversed(piece)
+				}
+				rings = append(rings, piece)
+			}
+		}
+	}
+	return assemble(windingBoundary(rings), func(ring Coordinates) bool {
+		return !ring.IsClockwise()
+	})
+}
+
+// Orient winds the exteriors of the polygons in g anticlockwise and
+// their holes clockwise, which is how GeoJSON expects them, and how
+// Buffer and MakeValid leave them.  Shapefiles wind them the other way.
+// Other geometries are returned as they are.
+func Orient(g Geometry) Geometry {
+	switch g := g.(type) {
+	case ZMGeometry:
+		return Orient(g.Geometry)
+	case Polygon:
+		oriented := make(Polygon, len(g))
+		for i, ring := range g {
+			if ring.IsClockwise() == (i == 0) {
+				ring = reversed(ring)
+			}
+			oriented[i] = ring
+		}
+		return oriented
+	case MultiPolygon:
+		oriented := make(MultiPolygon, len(g))
+		for i, polygon := range g {
+			oriented[i] = Orient(polygon).(Polygon)
+		}
+		return oriented
+	case GeometryCollection:
+		oriented := make(GeometryCollection, len(g))
+		for i, member := range g {
+			oriented[i] = Orient(member)
+		}
+		return oriented
+	}
+	return g
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		wkt      string
+		expected error
+	}{
+		{"POINT (1 2)", nil},
+		{"LINESTRING (0 0, 1 1)", nil},
+		{"LINESTRING (0 0)", ErrTooFewPoints},
+		{"LINESTRING (0 0, 1 1, 1 1, 2 0)", ErrRepeatedPoint},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 2 4, 4 4, 4 2, 2 2))", nil},
+		// the way the rings wind doesn't matter
+		{"POLYGON ((0 0, 0 10, 10 10, 10 0, 0 0))", nil},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10))", ErrUnclosedRing},
+		{"POLYGON ((0 0, 10 0, 0 0))", ErrTooFewPoints},
+		{"POLYGON ((0 0, 10 0, 20 0, 0 0))", ErrSelfIntersection},
+		{"POLYGON ((0 0, 10 10, 10 0, 0 10, 0 0))", ErrSelfIntersection},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (5 5, 15 5, 15 6, 5 6, 5 5))", ErrSelfIntersection},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (20 20, 20 21, 21 21, 20 20))", ErrHoleOutside},
+		{"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0)), ((20 0, 30 0, 30 10, 20 10, 20 0)))", nil},
+		{"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0)), ((2 2, 4 2, 4 4, 2 4, 2 2)))", ErrOverlap},
+		// but one may sit in a hole of another
+		{"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0), (1 1, 1 9, 9 9, 9 1, 1 1)), ((2 2, 4 2, 4 4, 2 4, 2 2)))", nil},
+	}
+	for _, c := range cases {
+		if err := Validate(mustWKT(t, c.wkt)); err != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.wkt, c.expected, err)
+		}
+	}
+	if err := Validate(Coordinates{{0, 0}, {math.NaN(), 1}}); err != ErrNonFinite {
+		t.Errorf("expected a NaN to be found, got %v", err)
+	}
+}
+
+func TestMakeValid(t *testing.T) {
+	cases := []struct {
+		wkt      string
+		polygons int
+		holes    int
+		area     float64
+	}{
+		// unclosed, and with a repeated point
+		{"POLYGON ((0 0, 10 0, 10 0, 10 10, 0 10))", 1, 0, 100},
+		// a bow tie comes apart into its two halves
+		{"POLYGON ((0 0, 10 10, 10 0, 0 10, 0 0))", 2, 0, 50},
+		// a ring that goes out to the hole and back around it
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 5, 2 5, 2 8, 8 8, 8 2, 2 2, 2 5, 0 5, 0 0))", 1, 1, 64},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (5 5, 15 5, 15 6, 5 6, 5 5))", 1, 0, 95},
+		{"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (20 20, 20 21, 21 21, 20 20))", 1, 0, 100},
+		{"MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0)), ((5 0, 15 0, 15 10, 5 10, 5 0)))", 1, 0, 150},
+		{"POLYGON ((0 0, 10 0, 20 0, 0 0))", 0, 0, 0},
+	}
+	for _, c := range cases {
+		repaired := MakeValid(mustWKT(t, c.wkt))
+		if err := Validate(repaired); err != nil {
+			t.Errorf("%s: repaired to %s, which is invalid: %v", c.wkt, wkt(t, repaired), err)
+		}
+		polygons, ok := repaired.(MultiPolygon)
+		if !ok {
+			t.Errorf("%s: expected a MultiPolygon, got %s", c.wkt, wkt(t, repaired))
+			continue
+		}
+		holes := 0
+		for _, polygon := range polygons {
+			holes += len(polygon.Interiors())
+		}
+		if len(polygons) != c.polygons || holes != c.holes || !near(Area(polygons), c.area, 1e-9) {
+			t.Errorf("%s: expected %d polygons, %d holes and an area of %v, got %s",
+				c.wkt, c.polygons, c.holes, c.area, wkt(t, repaired))
+		}
+	}
+
+	line := mustWKT(t, "LINESTRING (0 0, 1 1, 1 1, 2 0)")
+	if repaired := wkt(t, MakeValid(line)); repaired != "LINESTRING (0 0, 1 1, 2 0)" {
+		t.Errorf("expected the repeated point to go, got %s", repaired)
+	}
+	valid := mustWKT(t, "POLYGON ((0 0, 0 10, 10 10, 10 0, 0 0))")
+	if repaired := MakeValid(valid); wkt(t, repaired) != wkt(t, valid) {
+		t.Errorf("expected a valid polygon to be left alone, got %s", wkt(t, repaired))
+	}
+}
+
+func TestOrient(t *testing.T) {
+	cw := mustWKT(t, "POLYGON ((0 0, 0 10, 10 10, 10 0, 0 0), (2 2, 4 2, 4 4, 2 4, 2 2))")
+	oriented := Orient(cw).(Polygon)
+	if oriented.Exterior().IsClockwise() || !oriented[1].IsClockwise() {
+		t.Errorf("expected an anticlockwise exterior and a clockwise hole, got %s", wkt(t, oriented))
+	}
+	if again := Orient(oriented); wkt(t, again) != wkt(t, oriented) {
+		t.Errorf("expected orienting twice to change nothing, got %s", wkt(t, again))
+	}
+}
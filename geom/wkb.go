@@ -0,0 +1,377 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrBadWKB = errors.New("Malformed WKB")
+
+const (
+	wkbPoint uint32 = iota + 1
+	wkbLineString
+	wkbPolygon
+	wkbMultiPoint
+	wkbMultiLineString
+	wkbMultiPolygon
+	wkbGeometryCollection
+)
+
+// Flags that PostGIS sets on the type of an extended WKB geometry.
+const (
+	ewkbZ    uint32 = 0x80000000
+	ewkbM    uint32 = 0x40000000
+	ewkbSRID uint32 = 0x20000000
+)
+
+// MarshalWKB writes g as Well-Known Binary in the given byte order.  A
+// ZMGeometry has the ISO types of the Z, M or ZM variant.
+func MarshalWKB(g Geometry, order binary.ByteOrder) ([]byte, error) {
+	w := &wkbWriter{order: order}
+	if err := w.geometry(g, 0, false); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// MarshalEWKB writes g as PostGIS extended WKB tagged with srid.  A
+// ZMGeometry has the Z and M flags set on its types.
+func MarshalEWKB(g Geometry, srid int, order binary.ByteOrder) ([]byte, error) {
+	w := &wkbWriter{order: order, extended: true}
+	if err := w.geometry(g, uint32(srid), true); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type wkbWriter struct {
+	buf      bytes.Buffer
+	order    binary.ByteOrder
+	extended bool
+	zm       *ZMCursor
+	scratch  [8]byte
+}
+
+func (w *wkbWriter) uint32(v uint32) {
+	w.order.PutUint32(w.scratch[:4], v)
+	w.buf.Write(w.scratch[:4])
+}
+
+func (w *wkbWriter) float64(v float64) {
+	w.order.PutUint64(w.scratch[:], math.Float64bits(v))
+	w.buf.Write(w.scratch[:])
+}
+
+func (w *wkbWriter) header(ty uint32, srid uint32, withSRID bool) {
+	if w.order == binary.BigEndian {
+		w.buf.WriteByte(0)
+	} else {
+		w.buf.WriteByte(1)
+	}
+	z, m := w.zm.Has()
+	switch {
+	case w.extended && z:
+		ty |= ewkbZ
+	case z:
+		ty += 1000
+	}
+	switch {
+	case w.extended && m:
+		ty |= ewkbM
+	case m:
+		ty += 2000
+	}
+	if withSRID {
+		w.uint32(ty | ewkbSRID)
+		w.uint32(srid)
+	} else {
+		w.uint32(ty)
+	}
+}
+
+func (w *wkbWriter) point(p Point) {
+	w.float64(p[0])
+	w.float64(p[1])
+	for _, v := range w.zm.pick(w.zm.Next()) {
+		w.float64(v)
+	}
+}
+
+func (w *wkbWriter) coords(coords Coordinates) {
+	w.uint32(uint32(len(coords)))
+	for _, p := range coords {
+		w.point(p)
+	}
+}
+
+func (w *wkbWriter) rings(rings []Coordinates) {
+	w.uint32(uint32(len(rings)))
+	for _, ring := range rings {
+		w.coords(ring)
+	}
+}
+
+func (w *wkbWriter) geometry(g Geometry, srid uint32, withSRID bool) error {
+	switch g := g.(type) {
+	case ZMGeometry:
+		w.zm = NewZMCursor(g.Values)
+		return w.geometry(g.Geometry, srid, withSRID)
+	case Point:
+		w.header(wkbPoint, srid, withSRID)
+		w.point(g)
+	case Coordinates:
+		w.header(wkbLineString, srid, withSRID)
+		w.coords(g)
+	case Polygon:
+		w.header(wkbPolygon, srid, withSRID)
+		w.rings(g)
+	case MultiPoint:
+		w.header(wkbMultiPoint, srid, withSRID)
+		w.uint32(uint32(len(g)))
+		for _, p := range g {
+			w.geometry(p, 0, false)
+		}
+	case Multiline:
+		w.header(wkbMultiLineString, srid, withSRID)
+		w.uint32(uint32(len(g)))
+		for _, line := range g {
+			w.geometry(line, 0, false)
+		}
+	case MultiPolygon:
+		w.header(wkbMultiPolygon, srid, withSRID)
+		w.uint32(uint32(len(g)))
+		for _, p := range g {
+			w.geometry(p, 0, false)
+		}
+	case GeometryCollection:
+		w.header(wkbGeometryCollection, srid, withSRID)
+		w.uint32(uint32(len(g)))
+		for _, member := range g {
+			if err := w.geometry(member, 0, false); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrUnsupportedGeometry
+	}
+	return nil
+}
+
+// UnmarshalWKB reads a geometry from either ISO or PostGIS extended
+// WKB.  Any SRID is dropped, and Z and M geometries are read as a
+// ZMGeometry.
+func UnmarshalWKB(b []byte) (Geometry, error) {
+	g, _, err := UnmarshalEWKB(b)
+	return g, err
+}
+
+// UnmarshalEWKB is like UnmarshalWKB but also returns the SRID, which
+// is 0 if b did not carry one.
+func UnmarshalEWKB(b []byte) (Geometry, int, error) {
+	r := &wkbReader{b: b}
+	g, srid, err := r.geometry()
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.pos != len(b) {
+		return nil, 0, ErrBadWKB
+	}
+	return r.zm.Wrap(g), int(srid), nil
+}
+
+type wkbReader struct {
+	b     []byte
+	pos   int
+	order binary.ByteOrder
+	dims  int
+	z, m  bool
+	zm    ZMReader
+	err   error
+}
+
+func (r *wkbReader) uint32() uint32 {
+	if r.err != nil || r.pos+4 > len(r.b) {
+		r.err = ErrBadWKB
+		return 0
+	}
+	v := r.order.Uint32(r.b[r.pos:])
+	r.pos += 4
+	return v
+}
+
+func (r *wkbReader) float64() float64 {
+	if r.err != nil || r.pos+8 > len(r.b) {
+		r.err = ErrBadWKB
+		return 0
+	}
+	v := math.Float64frombits(r.order.Uint64(r.b[r.pos:]))
+	r.pos += 8
+	return v
+}
+
+// count reads a length prefix, refusing any that could not possibly
+// fit in the rest of the input.
+func (r *wkbReader) count(minSize int) int {
+	n := int(r.uint32())
+	if r.err == nil && n > (len(r.b)-r.pos)/minSize {
+		r.err = ErrBadWKB
+		return 0
+	}
+	return n
+}
+
+func (r *wkbReader) point() Point {
+	p := Point{r.float64(), r.float64()}
+	z, m := math.NaN(), math.NaN()
+	if r.z {
+		z = r.float64()
+	}
+	if r.m {
+		m = r.float64()
+	}
+	r.zm.Vertex(z, m)
+	return p
+}
+
+func (r *wkbReader) coords() Coordinates {
+	defer r.zm.EndPart()
+	n := r.count(8 * r.dims)
+	if n == 0 {
+		return nil
+	}
+	coords := make(Coordinates, n)
+	for i := range coords {
+		coords[i] = r.point()
+	}
+	return coords
+}
+
+func (r *wkbReader) rings() []Coordinates {
+	n := r.count(4)
+	if n == 0 {
+		return nil
+	}
+	rings := make([]Coordinates, n)
+	for i := range rings {
+		rings[i] = r.coords()
+	}
+	return rings
+}
+
+func (r *wkbReader) geometry() (Geometry, uint32, error) {
+	if r.pos >= len(r.b) {
+		return nil, 0, ErrBadWKB
+	}
+	switch r.b[r.pos] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return nil, 0, ErrBadWKB
+	}
+	r.pos++
+
+	ty := r.uint32()
+	var srid uint32
+	if ty&ewkbSRID != 0 {
+		srid = r.uint32()
+	}
+	r.z, r.m = ty&ewkbZ != 0, ty&ewkbM != 0
+	ty &^= ewkbZ | ewkbM | ewkbSRID
+	switch ty / 1000 {
+	case 1:
+		r.z = true
+	case 2:
+		r.m = true
+	case 3:
+		r.z, r.m = true, true
+	}
+	ty %= 1000
+	r.dims = 2
+	if r.z {
+		r.dims++
+	}
+	if r.m {
+		r.dims++
+	}
+	r.zm.HasZ = r.zm.HasZ || r.z
+	r.zm.HasM = r.zm.HasM || r.m
+
+	var g Geometry
+	switch ty {
+	case wkbPoint:
+		g = r.point()
+		r.zm.EndPart()
+	case wkbLineString:
+		g = r.coords()
+	case wkbPolygon:
+		g = Polygon(r.rings())
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon, wkbGeometryCollection:
+		n := r.count(5)
+		members := make(GeometryCollection, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			member, _, err := r.geometry()
+			if err != nil {
+				return nil, 0, err
+			}
+			members = append(members, member)
+		}
+		if g = collect(ty, members); g == nil {
+			r.err = ErrBadWKB
+		}
+	default:
+		r.err = ErrBadWKB
+	}
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	return g, srid, nil
+}
+
+// collect converts the members of a WKB multi-geometry to its concrete
+// type, or returns nil if a member has the wrong type.
+func collect(ty uint32, members GeometryCollection) Geometry {
+	switch ty {
+	case wkbMultiPoint:
+		var points MultiPoint
+		for _, member := range members {
+			p, ok := member.(Point)
+			if !ok {
+				return nil
+			}
+			points = append(points, p)
+		}
+		return points
+	case wkbMultiLineString:
+		var lines Multiline
+		for _, member := range members {
+			line, ok := member.(Coordinates)
+			if !ok {
+				return nil
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	case wkbMultiPolygon:
+		var polygons MultiPolygon
+		for _, member := range members {
+			p, ok := member.(Polygon)
+			if !ok {
+				return nil
+			}
+			polygons = append(polygons, p)
+		}
+		return polygons
+	}
+	if len(members) == 0 {
+		return GeometryCollection(nil)
+	}
+	return members
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+var wkbFixtures = []struct {
+	hex  string
+	wkt  string
+	srid int
+}{
+	{"0101000000000000000000f03f0000000000000040", "POINT (1 2)", 0},
+	{"00000000013ff00000000000004000000000000000", "POINT (1 2)", 0},
+	{"0101000020e6100000000000000000f03f0000000000000040", "POINT (1 2)", 4326},
+	{"01e9030000000000000000f03f00000000000000400000000000000840", "POINT Z (1 2 3)", 0},
+	{"01d1070000000000000000f03f00000000000000400000000000002240", "POINT M (1 2 9)", 0},
+	{"01020000c002000000000000000000f03f000000000000004000000000000008400000000000001040000000000000144000000000000018400000000000001c400000000000002040", "LINESTRING ZM (1 2 3 4, 5 6 7 8)", 0},
+	{"0101000000000000000000f87f000000000000f87f", "POINT EMPTY", 0},
+	{"010700000000000000", "GEOMETRYCOLLECTION EMPTY", 0},
+	{"01040000000200000000000000013ff00000000000004000000000000000010100000000000000000008400000000000001040", "MULTIPOINT ((1 2), (3 4))", 0},
+	{"0103000000010000000400000000000000000000000000000000000000000000000000f03f0000000000000000000000000000f03f000000000000f03f00000000000000000000000000000000", "POLYGON ((0 0, 1 0, 1 1, 0 0))", 0},
+}
+
+func TestWKBFixtures(t *testing.T) {
+	for _, fixture := range wkbFixtures {
+		b, _ := hex.DecodeString(fixture.hex)
+		g, srid, err := UnmarshalEWKB(b)
+		if err != nil {
+			t.Errorf("%s: %v", fixture.hex, err)
+			continue
+		}
+		if out, _ := MarshalWKT(g); out != fixture.wkt {
+			t.Errorf("%s: expected %s, got %s", fixture.hex, fixture.wkt, out)
+		}
+		if srid != fixture.srid {
+			t.Errorf("%s: expected srid %d, got %d", fixture.hex, fixture.srid, srid)
+		}
+	}
+}
+
+func TestWKBRoundTrip(t *testing.T) {
+	for _, fixture := range wktFixtures {
+		g, _ := UnmarshalWKT(fixture)
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			b, err := MarshalWKB(g, order)
+			if err != nil {
+				t.Errorf("%s: %v", fixture, err)
+				continue
+			}
+			decoded, err := UnmarshalWKB(b)
+			if err != nil {
+				t.Errorf("%s: %v", fixture, err)
+				continue
+			}
+			if out, _ := MarshalWKT(decoded); out != fixture {
+				t.Errorf("expected %s, got %s", fixture, out)
+			}
+		}
+	}
+}
+
+func TestEWKB(t *testing.T) {
+	b, err := MarshalEWKB(Point{1, 2}, 4326, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := hex.DecodeString(wkbFixtures[2].hex)
+	if !bytes.Equal(b, expected) {
+		t.Errorf("expected %x, got %x", expected, b)
+	}
+
+	// Z and M are flags on the type in EWKB, and add to it in ISO WKB
+	line := mustWKT(t, "LINESTRING ZM (1 2 3 4, 5 6 7 8)")
+	if b, _ = MarshalEWKB(line, 4326, binary.LittleEndian); hex.EncodeToString(b[:9]) != "01020000e0e6100000" {
+		t.Errorf("unexpected EWKB header %x", b[:9])
+	}
+	if g, _, _ := UnmarshalEWKB(b); wkt(t, g) != "LINESTRING ZM (1 2 3 4, 5 6 7 8)" {
+		t.Errorf("unexpected EWKB round trip %s", wkt(t, g))
+	}
+	if b, _ = MarshalWKB(line, binary.LittleEndian); hex.EncodeToString(b[:5]) != "01ba0b0000" {
+		t.Errorf("unexpected WKB header %x", b[:5])
+	}
+	b, _ = MarshalWKB(mustWKT(t, "POINT Z (1 2 3)"), binary.LittleEndian)
+	if expected, _ = hex.DecodeString(wkbFixtures[3].hex); !bytes.Equal(b, expected) {
+		t.Errorf("expected %x, got %x", expected, b)
+	}
+}
+
+func TestWKBTruncated(t *testing.T) {
+	for _, fixture := range wkbFixtures {
+		b, _ := hex.DecodeString(fixture.hex)
+		for i := 0; i < len(b); i++ {
+			if _, err := UnmarshalWKB(b[:i]); err == nil {
+				t.Errorf("%x should not decode", b[:i])
+			}
+		}
+		if _, err := UnmarshalWKB(append(b, 0)); err == nil {
+			t.Errorf("%x should not decode with trailing bytes", b)
+		}
+	}
+}
+
+func TestWKBHugeCount(t *testing.T) {
+	b, _ := hex.DecodeString("0102000000ffffff7f")
+	if _, err := UnmarshalWKB(b); err != ErrBadWKB {
+		t.Errorf("expected ErrBadWKB, got %v", err)
+	}
+}
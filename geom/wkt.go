@@ -0,0 +1,442 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MarshalWKT writes g as Well-Known Text.  An empty point is a point
+// whose coordinates are NaN.  A ZMGeometry is written as the Z, M or ZM
+// variant, as its values call for.
+func MarshalWKT(g Geometry) (string, error) {
+	var buf bytes.Buffer
+	if err := writeWKT(&buf, g, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeWKT(buf *bytes.Buffer, g Geometry, zm *ZMCursor) error {
+	tag := func(name string) {
+		buf.WriteString(name)
+		buf.WriteString(zm.tag())
+		buf.WriteByte(' ')
+	}
+	switch g := g.(type) {
+	case ZMGeometry:
+		return writeWKT(buf, g.Geometry, NewZMCursor(g.Values))
+	case Point:
+		tag("POINT")
+		writeWKTPoint(buf, g, zm)
+	case Coordinates:
+		tag("LINESTRING")
+		writeWKTCoords(buf, g, zm)
+	case Polygon:
+		tag("POLYGON")
+		writeWKTRings(buf, g, zm)
+	case MultiPoint:
+		tag("MULTIPOINT")
+		if len(g) == 0 {
+			buf.WriteString("EMPTY")
+			break
+		}
+		buf.WriteByte('(')
+		for i, p := range g {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeWKTPoint(buf, p, zm)
+		}
+		buf.WriteByte(')')
+	case Multiline:
+		tag("MULTILINESTRING")
+		writeWKTRings(buf, g, zm)
+	case MultiPolygon:
+		tag("MULTIPOLYGON")
+		if len(g) == 0 {
+			buf.WriteString("EMPTY")
+			break
+		}
+		buf.WriteByte('(')
+		for i, p := range g {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeWKTRings(buf, p, zm)
+		}
+		buf.WriteByte(')')
+	case GeometryCollection:
+		tag("GEOMETRYCOLLECTION")
+		if len(g) == 0 {
+			buf.WriteString("EMPTY")
+			break
+		}
+		buf.WriteByte('(')
+		for i, member := range g {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeWKT(buf, member, zm); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(')')
+	default:
+		return ErrUnsupportedGeometry
+	}
+	return nil
+}
+
+func writeWKTPoint(buf *bytes.Buffer, p Point, zm *ZMCursor) {
+	if math.IsNaN(p[0]) && math.IsNaN(p[1]) {
+		zm.Next()
+		buf.WriteString("EMPTY")
+		return
+	}
+	buf.WriteByte('(')
+	writeWKTOrdinates(buf, p, zm)
+	buf.WriteByte(')')
+}
+
+func writeWKTOrdinates(buf *bytes.Buffer, p Point, zm *ZMCursor) {
+	buf.WriteString(strconv.FormatFloat(p[0], 'f', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(p[1], 'f', -1, 64))
+	z, m := zm.Next()
+	for _, v := range zm.pick(z, m) {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+}
+
+func writeWKTCoords(buf *bytes.Buffer, coords Coordinates, zm *ZMCursor) {
+	if len(coords) == 0 {
+		buf.WriteString("EMPTY")
+		return
+	}
+	buf.WriteByte('(')
+	for i, p := range coords {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeWKTOrdinates(buf, p, zm)
+	}
+	buf.WriteByte(')')
+}
+
+func writeWKTRings(buf *bytes.Buffer, rings []Coordinates, zm *ZMCursor) {
+	if len(rings) == 0 {
+		buf.WriteString("EMPTY")
+		return
+	}
+	buf.WriteByte('(')
+	for i, ring := range rings {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeWKTCoords(buf, ring, zm)
+	}
+	buf.WriteByte(')')
+}
+
+// UnmarshalWKT reads a geometry from Well-Known Text.  The Z, M and ZM
+// variants are read as a ZMGeometry.  Points with three ordinates and
+// no tag have a Z, and those with four have both.
+func UnmarshalWKT(s string) (Geometry, error) {
+	p := &wktParser{s: s}
+	g, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, p.errorf("unexpected %q after geometry", tok)
+	}
+	return p.zm.Wrap(g), nil
+}
+
+type wktParser struct {
+	s   string
+	pos int
+	// dims is the number of ordinates per point in the current
+	// geometry, or 0 if it was not given and should be inferred, and
+	// z and m say which of them follow x and y.
+	dims int
+	z, m bool
+	zm   ZMReader
+}
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("wkt: column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next token without consuming it.
+func (p *wktParser) peek() string {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return ""
+	}
+	switch c := p.s[p.pos]; c {
+	case '(', ')', ',':
+		return p.s[p.pos : p.pos+1]
+	}
+	end := p.pos
+	for end < len(p.s) && strings.IndexByte(" \t\r\n(),", p.s[end]) < 0 {
+		end++
+	}
+	return p.s[p.pos:end]
+}
+
+func (p *wktParser) next() string {
+	tok := p.peek()
+	p.pos += len(tok)
+	return tok
+}
+
+func (p *wktParser) expect(tok string) error {
+	if got := p.peek(); got != tok {
+		if got == "" {
+			return p.errorf("expected %q, got end of input", tok)
+		}
+		return p.errorf("expected %q, got %q", tok, got)
+	}
+	p.next()
+	return nil
+}
+
+// empty consumes EMPTY if it is next, or the opening parenthesis
+// otherwise.
+func (p *wktParser) empty() (bool, error) {
+	if strings.EqualFold(p.peek(), "EMPTY") {
+		p.next()
+		return true, nil
+	}
+	return false, p.expect("(")
+}
+
+func (p *wktParser) geometry() (Geometry, error) {
+	tag := strings.ToUpper(p.peek())
+	if tag == "" {
+		return nil, p.errorf("expected a geometry, got end of input")
+	}
+	p.dims, p.z, p.m = 0, false, false
+	for _, suffix := range []string{"ZM", "Z", "M"} {
+		if strings.HasSuffix(tag, suffix) && wktTypes[strings.TrimSuffix(tag, suffix)] {
+			tag = strings.TrimSuffix(tag, suffix)
+			p.variant(suffix)
+			break
+		}
+	}
+	if !wktTypes[tag] {
+		return nil, p.errorf("unknown geometry type %q", tag)
+	}
+	p.next()
+	switch suffix := strings.ToUpper(p.peek()); suffix {
+	case "Z", "M", "ZM":
+		p.next()
+		p.variant(suffix)
+	}
+
+	switch tag {
+	case "POINT":
+		return p.point()
+	case "LINESTRING":
+		return p.coords()
+	case "POLYGON":
+		rings, err := p.rings()
+		return Polygon(rings), err
+	case "MULTIPOINT":
+		return p.multiPoint()
+	case "MULTILINESTRING":
+		rings, err := p.rings()
+		return Multiline(rings), err
+	case "MULTIPOLYGON":
+		return p.multiPolygon()
+	default:
+		return p.collection()
+	}
+}
+
+// variant sets the ordinates that follow x and y from the suffix of
+// the geometry's type.
+func (p *wktParser) variant(suffix string) {
+	p.z, p.m = strings.Contains(suffix, "Z"), strings.Contains(suffix, "M")
+	p.dims = 2 + len(suffix)
+	p.zm.HasZ = p.zm.HasZ || p.z
+	p.zm.HasM = p.zm.HasM || p.m
+}
+
+var wktTypes = map[string]bool{
+	"POINT": true, "LINESTRING": true, "POLYGON": true,
+	"MULTIPOINT": true, "MULTILINESTRING": true, "MULTIPOLYGON": true,
+	"GEOMETRYCOLLECTION": true,
+}
+
+func (p *wktParser) ordinates() (Point, error) {
+	var ords []float64
+	for {
+		tok := p.peek()
+		if tok == "" || tok == "," || tok == ")" || tok == "(" {
+			break
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return Point{}, p.errorf("bad number %q", tok)
+		}
+		p.next()
+		ords = append(ords, f)
+	}
+	switch {
+	case p.dims == 0 && len(ords) == 3:
+		p.variant("Z")
+	case p.dims == 0 && len(ords) == 4:
+		p.variant("ZM")
+	case p.dims == 0 && len(ords) == 2:
+		p.dims = 2
+	}
+	if p.dims == 0 {
+		return Point{}, p.errorf("expected 2 to 4 ordinates, got %d", len(ords))
+	}
+	if len(ords) != p.dims {
+		return Point{}, p.errorf("expected %d ordinates, got %d", p.dims, len(ords))
+	}
+	z, m := math.NaN(), math.NaN()
+	if p.z {
+		z = ords[2]
+	}
+	if p.m {
+		m = ords[p.dims-1]
+	}
+	p.zm.Vertex(z, m)
+	return Point{ords[0], ords[1]}, nil
+}
+
+func (p *wktParser) point() (Point, error) {
+	defer p.zm.EndPart()
+	if empty, err := p.empty(); empty || err != nil {
+		p.zm.Vertex(math.NaN(), math.NaN())
+		return Point{math.NaN(), math.NaN()}, err
+	}
+	pt, err := p.ordinates()
+	if err != nil {
+		return pt, err
+	}
+	return pt, p.expect(")")
+}
+
+func (p *wktParser) coords() (Coordinates, error) {
+	defer p.zm.EndPart()
+	if empty, err := p.empty(); empty || err != nil {
+		return nil, err
+	}
+	var coords Coordinates
+	for {
+		pt, err := p.ordinates()
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, pt)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return coords, p.expect(")")
+}
+
+func (p *wktParser) rings() ([]Coordinates, error) {
+	if empty, err := p.empty(); empty || err != nil {
+		return nil, err
+	}
+	var rings []Coordinates
+	for {
+		ring, err := p.coords()
+		if err != nil {
+			return nil, err
+		}
+		rings = append(rings, ring)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return rings, p.expect(")")
+}
+
+// multiPoint accepts both MULTIPOINT (1 2, 3 4) and the parenthesized
+// MULTIPOINT ((1 2), (3 4)).
+func (p *wktParser) multiPoint() (MultiPoint, error) {
+	if empty, err := p.empty(); empty || err != nil {
+		return nil, err
+	}
+	var points MultiPoint
+	for {
+		var pt Point
+		var err error
+		if tok := strings.ToUpper(p.peek()); tok == "(" || tok == "EMPTY" {
+			pt, err = p.point()
+		} else {
+			pt, err = p.ordinates()
+			p.zm.EndPart()
+		}
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return points, p.expect(")")
+}
+
+func (p *wktParser) multiPolygon() (MultiPolygon, error) {
+	if empty, err := p.empty(); empty || err != nil {
+		return nil, err
+	}
+	var polygons MultiPolygon
+	for {
+		rings, err := p.rings()
+		if err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, Polygon(rings))
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return polygons, p.expect(")")
+}
+
+func (p *wktParser) collection() (GeometryCollection, error) {
+	if empty, err := p.empty(); empty || err != nil {
+		return nil, err
+	}
+	var gc GeometryCollection
+	for {
+		g, err := p.geometry()
+		if err != nil {
+			return nil, err
+		}
+		gc = append(gc, g)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return gc, p.expect(")")
+}
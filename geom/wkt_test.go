@@ -0,0 +1,114 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"strings"
+	"testing"
+)
+
+var wktFixtures = []string{
+	"POINT (1 2)",
+	"POINT (-118.944862413904 34.823301)",
+	"POINT EMPTY",
+	"LINESTRING (0 0, 1 1, 2 0.5)",
+	"LINESTRING EMPTY",
+	"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 2 4, 4 4, 4 2, 2 2))",
+	"POLYGON EMPTY",
+	"MULTIPOINT ((1 2), (3 4))",
+	"MULTIPOINT ((1 2), EMPTY)",
+	"MULTIPOINT EMPTY",
+	"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3))",
+	"MULTILINESTRING (EMPTY, (2 2, 3 3))",
+	"MULTILINESTRING EMPTY",
+	"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5), (5.1 5.1, 5.2 5.1, 5.2 5.2, 5.1 5.1)))",
+	"MULTIPOLYGON (EMPTY, ((0 0, 1 0, 1 1, 0 0)))",
+	"MULTIPOLYGON EMPTY",
+	"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (0 0, 1 1), GEOMETRYCOLLECTION EMPTY)",
+	"GEOMETRYCOLLECTION EMPTY",
+	"POINT Z (1 2 3)",
+	"POINT M (1 2 3)",
+	"POINT ZM (1 2 3 4)",
+	"LINESTRING M (0 0 1, 1 1 2)",
+	"POLYGON Z ((0 0 1, 10 0 2, 10 10 3, 0 0 1), (2 2 5, 2 4 5, 4 4 5, 2 2 5))",
+	"MULTIPOINT Z ((1 2 3), EMPTY, (4 5 6))",
+	"MULTILINESTRING ZM ((0 0 1 2, 1 1 3 4), (2 2 5 6, 3 3 7 8))",
+	"GEOMETRYCOLLECTION Z (POINT Z (1 2 3), LINESTRING Z (0 0 1, 1 1 2))",
+}
+
+func TestWKTRoundTrip(t *testing.T) {
+	for _, fixture := range wktFixtures {
+		g, err := UnmarshalWKT(fixture)
+		if err != nil {
+			t.Errorf("%s: %v", fixture, err)
+			continue
+		}
+		out, err := MarshalWKT(g)
+		if err != nil {
+			t.Errorf("%s: %v", fixture, err)
+		} else if out != fixture {
+			t.Errorf("expected %s, got %s", fixture, out)
+		}
+	}
+}
+
+func TestWKTVariants(t *testing.T) {
+	variants := map[string]string{
+		"point(1 2)":                           "POINT (1 2)",
+		"  POINT ( 1   2 ) ":                   "POINT (1 2)",
+		"POINT Z (1 2 3)":                      "POINT Z (1 2 3)",
+		"POINTZ (1 2 3)":                       "POINT Z (1 2 3)",
+		"POINT (1 2 3)":                        "POINT Z (1 2 3)",
+		"point m (1 2 3)":                      "POINT M (1 2 3)",
+		"POINT (1 2 3 4)":                      "POINT ZM (1 2 3 4)",
+		"LINESTRINGZM (1 2 3 4, 5 6 7 8)":      "LINESTRING ZM (1 2 3 4, 5 6 7 8)",
+		"MULTIPOINT (1 2, 3 4)":                "MULTIPOINT ((1 2), (3 4))",
+		"MULTIPOINT Z (1 2 3, 4 5 6)":          "MULTIPOINT Z ((1 2 3), (4 5 6))",
+		"POINT (1e3 -2.5E-1)":                  "POINT (1000 -0.25)",
+		"GEOMETRYCOLLECTION (POINT Z (1 2 3))": "GEOMETRYCOLLECTION Z (POINT Z (1 2 3))",
+	}
+	for in, expected := range variants {
+		g, err := UnmarshalWKT(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if out, _ := MarshalWKT(g); out != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, out)
+		}
+	}
+}
+
+func TestWKTErrors(t *testing.T) {
+	bad := map[string]string{
+		"":                        "end of input",
+		"CIRCLE (1 2)":            "column 1",
+		"POINT (1)":               "2 to 4 ordinates",
+		"POINT Z (1 2)":           "expected 3 ordinates",
+		"POINT (1 2":              "end of input",
+		"POINT (1 two)":           `bad number "two"`,
+		"LINESTRING (1 2, 3 4 5)": "expected 2 ordinates",
+		"POINT (1 2) POINT (3 4)": "column 13",
+		"POLYGON (0 0, 1 1)":      `expected "("`,
+	}
+	for in, msg := range bad {
+		_, err := UnmarshalWKT(in)
+		if err == nil {
+			t.Errorf("%q should not parse", in)
+		} else if !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q: expected an error mentioning %q, got %q", in, msg, err)
+		}
+	}
+}
+
+type otherGeometry struct{}
+
+func (otherGeometry) Bbox() Bbox { return EmptyBbox() }
+
+func TestWKTUnsupported(t *testing.T) {
+	if _, err := MarshalWKT(otherGeometry{}); err != ErrUnsupportedGeometry {
+		t.Errorf("expected ErrUnsupportedGeometry, got %v", err)
+	}
+}
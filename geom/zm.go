@@ -0,0 +1,206 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"strconv"
+)
+
+// ZM holds the elevation and the measure of each vertex of a line or
+// ring, in the same order as its points.  Either is nil when the line
+// doesn't carry it, and a vertex without a value has NaN.
+type ZM struct {
+	Z, M []float64
+}
+
+// ZMShape is implemented by shapes whose vertices carry Z or M values.
+// There is one ZM for each line or ring of the shape, in the order
+// they appear in its geometry.  Only the shp source and the WKT and WKB
+// codecs carry them: densifying, clipping, simplifying and projecting
+// work on x and y alone, so the values belong to the shape as it was
+// read, not to what is drawn of it.
+type ZMShape interface {
+	Shape
+	ZM() []ZM
+}
+
+// ZMAttribute gives the Z and M values of a shape as attributes, so
+// that filters and symbolizers can use them like any other.  "z" and
+// "m" are the values at the first vertex that has one, which suits
+// contours that are all at one height, and "z_min", "z_max", "m_min"
+// and "m_max" are their range over the whole shape.  It reports false
+// for any other name, or if the shape has no such values.
+func ZMAttribute(shape Shape, name string) (string, bool) {
+	s, ok := shape.(ZMShape)
+	if !ok {
+		return "", false
+	}
+	var values []float64
+	for _, zm := range s.ZM() {
+		switch name {
+		case "z", "z_min", "z_max":
+			values = append(values, zm.Z...)
+		case "m", "m_min", "m_max":
+			values = append(values, zm.M...)
+		default:
+			return "", false
+		}
+	}
+	v := math.NaN()
+	for _, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+		first := math.IsNaN(v)
+		switch name {
+		case "z", "m":
+			if first {
+				v = value
+			}
+		case "z_min", "m_min":
+			if first || value < v {
+				v = value
+			}
+		default:
+			if first || value > v {
+				v = value
+			}
+		}
+	}
+	if math.IsNaN(v) {
+		return "", false
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), true
+}
+
+// ZMGeometry is a geometry whose vertices carry Z or M values, as the
+// Z, M and ZM variants of WKT and WKB do.  Values has a ZM for each
+// line, ring and point of the geometry, in the order they are written.
+// The predicates and measures look through it to the plain Geometry,
+// and the transforms return the plain geometry, without the values.
+type ZMGeometry struct {
+	Geometry
+	Values []ZM
+}
+
+func (g ZMGeometry) ZM() []ZM {
+	return g.Values
+}
+
+// ZMCursor hands out the Z and M values of a ZMGeometry one vertex at
+// a time, in the order its vertices are written, for the encoders.  A
+// nil cursor has none.
+type ZMCursor struct {
+	z, m       []float64
+	hasZ, hasM bool
+	next       int
+}
+
+func NewZMCursor(values []ZM) *ZMCursor {
+	c := new(ZMCursor)
+	for _, zm := range values {
+		c.hasZ = c.hasZ || zm.Z != nil
+		c.hasM = c.hasM || zm.M != nil
+	}
+	for _, zm := range values {
+		n := len(zm.Z)
+		if len(zm.M) > n {
+			n = len(zm.M)
+		}
+		for i := 0; i < n; i++ {
+			c.z = append(c.z, valueAt(zm.Z, i))
+			c.m = append(c.m, valueAt(zm.M, i))
+		}
+	}
+	return c
+}
+
+func valueAt(values []float64, i int) float64 {
+	if i < len(values) {
+		return values[i]
+	}
+	return math.NaN()
+}
+
+// Next returns the Z and M of the next vertex, which are NaN if it has
+// none.
+func (c *ZMCursor) Next() (z, m float64) {
+	if c == nil || c.next >= len(c.z) {
+		return math.NaN(), math.NaN()
+	}
+	c.next++
+	return c.z[c.next-1], c.m[c.next-1]
+}
+
+// Has reports whether the geometry has Z and M values.
+func (c *ZMCursor) Has() (z, m bool) {
+	return c != nil && c.hasZ, c != nil && c.hasM
+}
+
+// tag is the suffix that WKT gives the type of the geometry.
+func (c *ZMCursor) tag() string {
+	switch z, m := c.Has(); {
+	case z && m:
+		return " ZM"
+	case z:
+		return " Z"
+	case m:
+		return " M"
+	}
+	return ""
+}
+
+// pick lists those of z and m that the geometry has.
+func (c *ZMCursor) pick(z, m float64) []float64 {
+	var values []float64
+	hasZ, hasM := c.Has()
+	if hasZ {
+		values = append(values, z)
+	}
+	if hasM {
+		values = append(values, m)
+	}
+	return values
+}
+
+// ZMReader collects the Z and M values of a geometry as the decoders
+// read it.  HasZ and HasM are set when the input gives either.
+type ZMReader struct {
+	HasZ, HasM bool
+	z, m       []float64
+	parts      []int
+}
+
+// Vertex records the values of the next vertex, NaN for those it
+// doesn't have.
+func (r *ZMReader) Vertex(z, m float64) {
+	r.z = append(r.z, z)
+	r.m = append(r.m, m)
+}
+
+// EndPart marks the end of a line, ring or point.
+func (r *ZMReader) EndPart() {
+	r.parts = append(r.parts, len(r.z))
+}
+
+// Wrap returns g with the values read, or g alone if it had none.
+func (r *ZMReader) Wrap(g Geometry) Geometry {
+	if !r.HasZ && !r.HasM {
+		return g
+	}
+	values := make([]ZM, len(r.parts))
+	start := 0
+	for i, end := range r.parts {
+		if r.HasZ {
+			values[i].Z = append([]float64{}, r.z[start:end]...)
+		}
+		if r.HasM {
+			values[i].M = append([]float64{}, r.m[start:end]...)
+		}
+		start = end
+	}
+	return ZMGeometry{g, values}
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+type zmLine struct {
+	line Coordinates
+	zm   ZM
+}
+
+func (l *zmLine) Bbox() Bbox                   { return l.line.Bbox() }
+func (l *zmLine) Attribute(name string) string { return "" }
+func (l *zmLine) Path() Coordinates            { return l.line }
+func (l *zmLine) ZM() []ZM                     { return []ZM{l.zm} }
+
+func TestZMAttribute(t *testing.T) {
+	route := &zmLine{
+		Coordinates{{0, 0}, {1, 0}, {2, 0}},
+		ZM{Z: []float64{math.NaN(), 120, 80.5}, M: []float64{0, 1.5, 3}},
+	}
+	cases := []struct {
+		name, expected string
+		ok             bool
+	}{
+		{"z", "120", true},
+		{"z_min", "80.5", true},
+		{"z_max", "120", true},
+		{"m", "0", true},
+		{"m_max", "3", true},
+		{"name", "", false},
+	}
+	for _, c := range cases {
+		if v, ok := ZMAttribute(route, c.name); v != c.expected || ok != c.ok {
+			t.Errorf("%s: expected %q, %v, got %q, %v", c.name, c.expected, c.ok, v, ok)
+		}
+	}
+
+	contour := &zmLine{Coordinates{{0, 0}, {1, 0}}, ZM{Z: []float64{10, 10}}}
+	if _, ok := ZMAttribute(contour, "m"); ok {
+		t.Error("expected a line without measures to have no m")
+	}
+	if _, ok := ZMAttribute(&zmLine{}, "z"); ok {
+		t.Error("expected a line without values to have no z")
+	}
+}
@@ -6,15 +6,26 @@ package mapping
 
 import (
 	"encoding/xml"
+	"github.com/samlecuyer/ecumene/query"
 	"github.com/samlecuyer/ecumene/sources"
+	"math"
+	"strings"
 )
 
+// Layer draws the shapes of a source in some styles.  Like a rule, it
+// may be limited to some scales, with the minzoom and maxzoom or the
+// minimum-scale-denominator and maximum-scale-denominator attributes.
 type Layer struct {
-	styles []string    `xml:"StyleName"`
-	source *Datasource `xml:"Datasource"`
+	styles    []string    `xml:"StyleName"`
+	source    *Datasource `xml:"Datasource"`
+	statement *query.Select
+	ScaleRange
 }
 
 func (l *Layer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := l.decodeScale(start, true); err != nil {
+		return err
+	}
 	for {
 		e, err := d.Token()
 		if err != nil {
@@ -46,24 +57,58 @@ func (l *Layer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 func (l *Layer) LoadSource() sources.DataSource {
 	source := l.source
-	if ds, err := sources.Open(source.Type, source.Format, source.Val); err == nil {
-		return ds
+	ds, err := sources.Open(source.Type, source.Format, source.Val)
+	if err != nil {
+		return nil
+	}
+	if source.Validate {
+		ds = sources.Validating(ds)
+	}
+	if source.Derive != "" {
+		derived, err := sources.Derived(ds, sources.Derivation{
+			Kind:    source.Derive,
+			GroupBy: source.GroupBy,
+			MaxEdge: source.MaxEdge * math.Pi / 180,
+		})
+		if err != nil {
+			ds.Close()
+			return nil
+		}
+		ds = derived
 	}
-	return nil
+	return sources.Selecting(ds)
 }
 
 func (l *Layer) Styles() []string {
 	return l.styles
 }
 
-// TODO: remove this, this is just to keep compatibility while I'm refactoring
-func (l *Layer) SourceQuery() string {
-	return l.source.Query
+// Statement is the layer's query, parsed by NewMap, or nil if it has
+// none.
+func (l *Layer) Statement() *query.Select {
+	return l.statement
+}
+
+func (l *Layer) compile() (err error) {
+	if l.source != nil && strings.TrimSpace(l.source.Query) != "" {
+		l.statement, err = query.ParseSelect(l.source.Query)
+	}
+	return
 }
 
 type Datasource struct {
 	Type   string `xml:"type,attr"`
 	Format string `xml:"format,attr"`
 	Val    string `xml:"name,attr"`
-	Query  string `xml:"Query"`
+	// Query is a statement in the subset of SQL that
+	// query.ParseSelect takes.
+	Query string `xml:"Query"`
+	// Validate checks every shape, and logs and repairs the invalid
+	// ones.  It is off by default, since it costs time.
+	Validate bool `xml:"validate,attr"`
+	// Derive replaces the points of the source with shapes computed
+	// out of them; see sources.Derivation.  MaxEdge is in degrees.
+	Derive  string  `xml:"derive,attr"`
+	GroupBy string  `xml:"group-by,attr"`
+	MaxEdge float64 `xml:"max-edge,attr"`
 }
@@ -9,6 +9,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"github.com/samlecuyer/ecumene/util"
 	proj "github.com/samlecuyer/projectron"
 	"os"
 	"math"
@@ -45,10 +47,7 @@ func (m *Map) setBounds(extent string) (err error) {
 	factor := math.Pi / 180.0
 	var x0, y0, x1, y1 float64
 	_, err = fmt.Sscanf(extent, "%f %f %f %f", &x0, &y0, &x1, &y1)
-	m.bounds[0] = x0 * factor
-	m.bounds[1] = y1 * factor
-	m.bounds[2] = x1 * factor
-	m.bounds[3] = y0 * factor
+	m.bounds = geom.NewBbox(x0*factor, y0*factor, x1*factor, y1*factor)
 	return
 }
 
@@ -113,8 +112,42 @@ func (m *Map) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	return d.Skip()
 }
 
+// NewMap loads a map, and compiles the filters and labels of its rules
+// and the queries of its layers.
 func NewMap(path string) (*Map, error) {
-	return loadFile(path)
+	m, err := loadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.compile(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// compile compiles the filter and the label of every rule and the query
+// of every layer, and reports the first that can't be, with where it came from.
+func (m *Map) compile() error {
+	for _, style := range m.Styles {
+		for i, rule := range style.Rules {
+			condition, err := query.Compile(rule.Filter)
+			if err != nil {
+				return fmt.Errorf("style %q, rule %d: filter %q: %v", style.Name, i+1, rule.Filter, err)
+			}
+			rule.Condition = condition
+			if ts, ok := rule.Symbolizers[util.TextType].(*TextSymbolizer); ok && ts.Attr != "" {
+				if ts.Label, err = query.Parse(ts.Attr); err != nil {
+					return fmt.Errorf("style %q, rule %d: label %q: %v", style.Name, i+1, ts.Attr, err)
+				}
+			}
+		}
+	}
+	for i, layer := range m.Layers {
+		if err := layer.compile(); err != nil {
+			return fmt.Errorf("layer %d: query %q: %v", i+1, layer.source.Query, err)
+		}
+	}
+	return nil
 }
 
 func loadFile(path string) (*Map, error) {
@@ -126,7 +159,9 @@ func loadFile(path string) (*Map, error) {
 
 	m := new(Map)
 	decoder := xml.NewDecoder(file)
-	decoder.Decode(m)
+	if err := decoder.Decode(m); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
@@ -139,7 +174,9 @@ func loadInclude(path string) (*Include, error) {
 
 	m := new(Include)
 	decoder := xml.NewDecoder(file)
-	decoder.Decode(m)
+	if err := decoder.Decode(m); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
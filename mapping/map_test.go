@@ -0,0 +1,99 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/samlecuyer/ecumene/util"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileFilters(t *testing.T) {
+	m := &Map{Styles: []*Style{
+		{Name: "roads", Rules: []*Rule{{Filter: ""}, {Filter: "[highway] = 'primary'"}}},
+		{Name: "water", Rules: []*Rule{{Filter: "natural = water"}, {Filter: "natural = (water"}}},
+	}}
+	err := m.compile()
+	if err == nil {
+		t.Fatal("expected the broken filter to be reported")
+	}
+	if msg := err.Error(); !strings.Contains(msg, `style "water", rule 2`) || !strings.Contains(msg, "column 17") {
+		t.Errorf("expected the error to say where the filter was, got %q", msg)
+	}
+	if m.Styles[0].Rules[0].Condition.Expr != nil || m.Styles[0].Rules[1].Condition.Expr == nil {
+		t.Error("expected the filters before the broken one to be compiled")
+	}
+
+	label := &TextSymbolizer{Attr: "concat(name, ' ', ref"}
+	m = &Map{Styles: []*Style{{Name: "labels", Rules: []*Rule{{
+		Symbolizers: map[util.SymbolizerType]Symbolizer{util.TextType: label},
+	}}}}}
+	if err := m.compile(); err == nil || !strings.Contains(err.Error(), `style "labels", rule 1: label`) {
+		t.Errorf("expected the broken label to be reported, got %v", err)
+	}
+	label.Attr = "upper(name)"
+	if err := m.compile(); err != nil || label.Label == nil {
+		t.Errorf("expected the label to compile, got %v", err)
+	}
+}
+
+func TestScaleRange(t *testing.T) {
+	var rule Rule
+	src := `<Rule><MinScaleDenominator>5000</MinScaleDenominator><MaxScaleDenominator>50000</MaxScaleDenominator></Rule>`
+	if err := xml.Unmarshal([]byte(src), &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Contains(4999) || !rule.Contains(5000) || !rule.Contains(49999) || rule.Contains(50000) {
+		t.Errorf("unexpected range %v", rule.ScaleRange)
+	}
+
+	var layer Layer
+	if err := xml.Unmarshal([]byte(`<Layer minzoom="10" maxzoom="12"></Layer>`), &layer); err != nil {
+		t.Fatal(err)
+	}
+	for zoom := 8; zoom <= 14; zoom++ {
+		want := zoom >= 10 && zoom <= 12
+		if got := layer.Contains(ScaleOfZoom(float64(zoom))); got != want {
+			t.Errorf("zoom %d: expected %v, got %v", zoom, want, got)
+		}
+	}
+	if z := Zoom(ScaleOfZoom(7)); math.Abs(z-7) > 1e-9 {
+		t.Errorf("expected zoom 7 back, got %v", z)
+	}
+}
+
+func TestNewMapScaleErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bad := []string{
+		`<Map><Style name="roads"><Rule minzoom="ten"></Rule></Style></Map>`,
+		`<Map><Layer maxzoom="12" minimum-scale-denominator="lots"></Layer></Map>`,
+	}
+	for i, src := range bad {
+		name := filepath.Join(dir, fmt.Sprintf("map%d.xml", i))
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewMap(name); err == nil {
+			t.Errorf("%s: expected the bad scale to be reported", src)
+		}
+	}
+
+	// rules give their denominators as elements, so the attributes are
+	// left alone
+	var rule Rule
+	if err := xml.Unmarshal([]byte(`<Rule minimum-scale-denominator="lots"></Rule>`), &rule); err != nil || rule.MinScale != 0 {
+		t.Errorf("expected the attribute to be ignored, got %v, %v", rule.ScaleRange, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+)
+
+// ZoomScale is the scale denominator of zoom level 0 of web map tiles,
+// a 256 pixel tile of the whole world at 0.28mm a pixel.
+const ZoomScale = 559082264.028
+
+// Zoom is the zoom level of web map tiles drawn at a scale denominator.
+func Zoom(scale float64) float64 {
+	return math.Log2(ZoomScale / scale)
+}
+
+// ScaleOfZoom is the scale denominator of a zoom level.
+func ScaleOfZoom(zoom float64) float64 {
+	return ZoomScale / math.Exp2(zoom)
+}
+
+// ScaleRange limits a rule or a layer to some scales.  It shows from
+// MinScale up to but not including MaxScale, which are scale
+// denominators, so MinScale is the most zoomed in.  Zero leaves that
+// end open.
+type ScaleRange struct {
+	MinScale, MaxScale float64
+}
+
+// Contains reports whether the range shows at a scale denominator.
+func (s ScaleRange) Contains(scale float64) bool {
+	return scale >= s.MinScale && (s.MaxScale == 0 || scale < s.MaxScale)
+}
+
+// setZoom narrows the range to zoom levels from minzoom to maxzoom.
+// The ends go halfway to the next levels, so that the levels
+// themselves are always in or out.
+func (s *ScaleRange) setZoom(name, value string) error {
+	zoom, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if name == "minzoom" {
+		s.MaxScale = ScaleOfZoom(zoom - 0.5)
+	} else {
+		s.MinScale = ScaleOfZoom(zoom + 0.5)
+	}
+	return nil
+}
+
+// decodeScale reads the ScaleRange of an element from its minzoom and
+// maxzoom attributes, and, if denominators is set, from its
+// minimum-scale-denominator and maximum-scale-denominator ones.  Rules
+// give their denominators as elements instead.
+func (s *ScaleRange) decodeScale(start xml.StartElement, denominators bool) error {
+	for _, attr := range start.Attr {
+		var err error
+		switch name := attr.Name.Local; {
+		case name == "minzoom" || name == "maxzoom":
+			err = s.setZoom(name, attr.Value)
+		case denominators && name == "minimum-scale-denominator":
+			s.MinScale, err = strconv.ParseFloat(attr.Value, 64)
+		case denominators && name == "maximum-scale-denominator":
+			s.MaxScale, err = strconv.ParseFloat(attr.Value, 64)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
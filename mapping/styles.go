@@ -8,6 +8,7 @@ import (
 	"code.google.com/p/sadbox/color"
 	"encoding/xml"
 	"fmt"
+	"github.com/samlecuyer/ecumene/query"
 	"github.com/samlecuyer/ecumene/util"
 )
 
@@ -20,13 +21,22 @@ func (s *Style) String() string {
 	return fmt.Sprintf("{%s %v}", s.Name, s.Rules)
 }
 
+// Rule draws the shapes that meet its filter at the scales in its
+// range, which come from <MinScaleDenominator> and
+// <MaxScaleDenominator>, or the minzoom and maxzoom attributes.
 type Rule struct {
-	Filter      string
+	Filter string
+	// Condition is Filter compiled, which NewMap does.
+	Condition query.Filter
+	ScaleRange
 	Symbolizers map[util.SymbolizerType]Symbolizer
 }
 
 func (r *Rule) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	r.Symbolizers = make(map[util.SymbolizerType]Symbolizer)
+	if err := r.decodeScale(start, false); err != nil {
+		return err
+	}
 	for {
 		e, err := d.Token()
 		if err != nil {
@@ -45,6 +55,14 @@ func (r *Rule) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 					return err
 				}
 				r.Filter = f
+			case "MinScaleDenominator":
+				if err := d.DecodeElement(&r.MinScale, &e); err != nil {
+					return err
+				}
+			case "MaxScaleDenominator":
+				if err := d.DecodeElement(&r.MaxScale, &e); err != nil {
+					return err
+				}
 			case "Polygon":
 				s := new(PolygonSymbolizer)
 				if err := d.DecodeElement(s, &e); err != nil {
@@ -73,27 +91,50 @@ type Symbolizer interface {
 	Name() string
 }
 
+// Simplification is shared by the symbolizers that draw lines and
+// rings.  The tolerance is in pixels, so that it follows the resolution
+// being drawn, unless the units are "map".  The algorithm is either
+// "douglas-peucker", the default, or "visvalingam-whyatt".
+type Simplification struct {
+	Simplify          float64 `xml:"simplify,attr"`
+	SimplifyAlgorithm string  `xml:"simplify-algorithm,attr"`
+	SimplifyUnits     string  `xml:"simplify-units,attr"`
+}
+
 type PolygonSymbolizer struct {
 	Fill color.Hex `xml:"fill,attr"`
+	Simplification
 }
 
 func (s *PolygonSymbolizer) Name() string {
 	return "Polygon"
 }
 
+// PathSymbolizer strokes lines.  A non-zero offset draws the line that
+// many pixels to its left, or to its right when negative.  Geodesic
+// lines follow great circles between their points, as flight paths do,
+// rather than straight lines in longitude and latitude.
 type PathSymbolizer struct {
-	Weight float64   `xml:"width,attr" default:"0.5"`
-	Stroke color.Hex `xml:"stroke,attr"`
+	Weight   float64   `xml:"width,attr" default:"0.5"`
+	Stroke   color.Hex `xml:"stroke,attr"`
+	Offset   float64   `xml:"offset,attr"`
+	Geodesic bool      `xml:"geodesic,attr"`
+	Simplification
 }
 
 func (s *PathSymbolizer) Name() string {
 	return "Path"
 }
 
+// TextSymbolizer labels shapes.  Its name is an expression, which may
+// be just the attribute to show, or something like "upper(name)"; see
+// query.Parse.
 type TextSymbolizer struct {
 	Size float64   `xml:"size,attr"`
 	Fill color.Hex `xml:"fill,attr"`
 	Attr string    `xml:"name,attr"`
+	// Label is Attr compiled, which NewMap does.
+	Label query.Expr `xml:"-"`
 }
 
 func (s *TextSymbolizer) Name() string {
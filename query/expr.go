@@ -0,0 +1,424 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Value is the result of evaluating an expression: a string, a float64
+// or a bool.
+type Value interface{}
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	Eval(shape geom.Shape) Value
+	String() string
+}
+
+// Truthy reports whether a value counts as true where a condition is
+// expected.  Strings are true unless they are empty.
+func Truthy(v Value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+func asString(v Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// asNumber reads a value as a number.  Attributes are text, so strings
+// that hold a finite number count as one; DBF pads numbers with spaces.
+// Text such as "NaN" or "Inf" is a name, not a number.
+func asNumber(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil && !math.IsNaN(n) && !math.IsInf(n, 0)
+	}
+	return 0, false
+}
+
+// compare orders two values, numerically if both are numbers and as
+// text otherwise.  It reports false if they can't be compared, which is
+// when one is a number literal and the other isn't a number.
+func compare(l, r Value) (int, bool) {
+	ln, lok := asNumber(l)
+	rn, rok := asNumber(r)
+	switch {
+	case lok && rok:
+		switch {
+		case ln < rn:
+			return -1, true
+		case ln > rn:
+			return 1, true
+		}
+		return 0, true
+	case isNumber(l) || isNumber(r):
+		return 0, false
+	}
+	return strings.Compare(asString(l), asString(r)), true
+}
+
+func isNumber(v Value) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+// walk calls f for e and every expression inside it.
+func walk(e Expr, f func(Expr)) {
+	if e == nil {
+		return
+	}
+	f(e)
+	switch e := e.(type) {
+	case *Binary:
+		walk(e.Left, f)
+		walk(e.Right, f)
+	case *Not:
+		walk(e.X, f)
+	case *Match:
+		walk(e.X, f)
+	case *Replace:
+		walk(e.X, f)
+	case *Call:
+		for _, arg := range e.Args {
+			walk(arg, f)
+		}
+	case *In:
+		walk(e.X, f)
+		for _, item := range e.List {
+			walk(item, f)
+		}
+	case *IsNull:
+		walk(e.X, f)
+	case *Regexp:
+		walk(e.X, f)
+	}
+}
+
+// rewrite rebuilds e from the bottom up, replacing every expression
+// with what f returns for it.
+func rewrite(e Expr, f func(Expr) Expr) Expr {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case *Binary:
+		return f(&Binary{e.Op, rewrite(e.Left, f), rewrite(e.Right, f)})
+	case *Not:
+		return f(&Not{rewrite(e.X, f)})
+	case *Match:
+		return f(&Match{rewrite(e.X, f), e.Pattern})
+	case *Replace:
+		return f(&Replace{rewrite(e.X, f), e.Pattern, e.With})
+	case *Call:
+		args := make([]Expr, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = rewrite(arg, f)
+		}
+		return f(&Call{e.Name, args, e.fn})
+	case *In:
+		list := make([]Expr, len(e.List))
+		for i, item := range e.List {
+			list[i] = rewrite(item, f)
+		}
+		return f(&In{rewrite(e.X, f), list, e.Not})
+	case *IsNull:
+		return f(&IsNull{rewrite(e.X, f), e.Not})
+	case *Regexp:
+		return f(&Regexp{rewrite(e.X, f), e.Pattern, e.Not})
+	}
+	return f(e)
+}
+
+// Field is the value of one of the shape's attributes.
+type Field struct {
+	Name string
+}
+
+// Eval is nil if the shape doesn't have the attribute, so that IS NULL
+// can tell it from one that is empty; elsewhere, nil is empty text.
+func (f *Field) Eval(shape geom.Shape) Value {
+	if v, ok := geom.LookupAttribute(shape, f.Name); ok {
+		return v
+	}
+	return nil
+}
+
+func (f *Field) String() string {
+	for _, r := range f.Name {
+		if !isWordRune(r) {
+			return "[" + f.Name + "]"
+		}
+	}
+	return f.Name
+}
+
+// GeometryType is the kind of the shape's geometry; see geometryType.
+type GeometryType struct{}
+
+func (g *GeometryType) Eval(shape geom.Shape) Value {
+	return geometryType(shape)
+}
+
+func (g *GeometryType) String() string {
+	return "geometry_type"
+}
+
+// Variable is a value that is the same for every shape, like the zoom
+// being drawn.  It is nil until it is bound; see Filter.Bind.
+type Variable struct {
+	Name string
+}
+
+func (v *Variable) Eval(shape geom.Shape) Value {
+	return nil
+}
+
+func (v *Variable) String() string {
+	return "@" + v.Name
+}
+
+// Literal is a constant value.
+type Literal struct {
+	Value Value
+}
+
+func (l *Literal) Eval(shape geom.Shape) Value {
+	return l.Value
+}
+
+func (l *Literal) String() string {
+	if s, ok := l.Value.(string); ok {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+	if l.Value == nil {
+		return "null"
+	}
+	return asString(l.Value)
+}
+
+// Op is a binary operator.
+type Op int
+
+const (
+	OpAnd Op = iota
+	OpOr
+	OpEq
+	OpNe
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+	OpContains
+)
+
+var opNames = [...]string{"and", "or", "=", "!=", "<", "<=", ">", ">=", "contains"}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// Binary applies an operator to two expressions.  Comparisons are
+// numeric when both sides are numbers, so "lanes >= 4" holds for "10";
+// otherwise they compare text.  A number never equals something that
+// isn't one.
+type Binary struct {
+	Op          Op
+	Left, Right Expr
+}
+
+func (b *Binary) Eval(shape geom.Shape) Value {
+	switch b.Op {
+	case OpAnd:
+		return Truthy(b.Left.Eval(shape)) && Truthy(b.Right.Eval(shape))
+	case OpOr:
+		return Truthy(b.Left.Eval(shape)) || Truthy(b.Right.Eval(shape))
+	}
+	l, r := b.Left.Eval(shape), b.Right.Eval(shape)
+	if b.Op == OpContains {
+		return strings.Contains(asString(l), asString(r))
+	}
+	c, ok := compare(l, r)
+	if !ok {
+		return b.Op == OpNe
+	}
+	switch b.Op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGe:
+		return c >= 0
+	}
+	return false
+}
+
+func (b *Binary) String() string {
+	return fmt.Sprintf("(%v %v %v)", b.Left, b.Op, b.Right)
+}
+
+// Not negates a condition.
+type Not struct {
+	X Expr
+}
+
+func (n *Not) Eval(shape geom.Shape) Value {
+	return !Truthy(n.X.Eval(shape))
+}
+
+func (n *Not) String() string {
+	return fmt.Sprintf("(not %v)", n.X)
+}
+
+// Match is true if the whole of a value matches a regular expression.
+type Match struct {
+	X       Expr
+	Pattern *regexp.Regexp
+}
+
+func (m *Match) Eval(shape geom.Shape) Value {
+	return m.Pattern.MatchString(asString(m.X.Eval(shape)))
+}
+
+func (m *Match) String() string {
+	s := m.Pattern.String()
+	return fmt.Sprintf("%v.match(%v)", m.X, &Literal{s[len("^(?:") : len(s)-len(")$")]})
+}
+
+// Replace replaces every match of a regular expression in a value.
+type Replace struct {
+	X       Expr
+	Pattern *regexp.Regexp
+	With    string
+}
+
+func (r *Replace) Eval(shape geom.Shape) Value {
+	return r.Pattern.ReplaceAllString(asString(r.X.Eval(shape)), r.With)
+}
+
+func (r *Replace) String() string {
+	return fmt.Sprintf("%v.replace(%v, %v)", r.X, &Literal{r.Pattern.String()}, &Literal{r.With})
+}
+
+// Call calls a function; see Parse for those there are.
+type Call struct {
+	Name string
+	Args []Expr
+	fn   function
+}
+
+func (c *Call) Eval(shape geom.Shape) Value {
+	args := make([]Value, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.Eval(shape)
+	}
+	return c.fn.call(shape, args)
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return c.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// In is true if a value equals one of a list, or with Not, none of
+// them.  Values compare as they do with =.
+type In struct {
+	X    Expr
+	List []Expr
+	Not  bool
+}
+
+func (in *In) Eval(shape geom.Shape) Value {
+	x := in.X.Eval(shape)
+	for _, item := range in.List {
+		if c, ok := compare(x, item.Eval(shape)); ok && c == 0 {
+			return !in.Not
+		}
+	}
+	return in.Not
+}
+
+func (in *In) String() string {
+	list := make([]string, len(in.List))
+	for i, item := range in.List {
+		list[i] = item.String()
+	}
+	op := "in"
+	if in.Not {
+		op = "not in"
+	}
+	return fmt.Sprintf("(%v %s (%s))", in.X, op, strings.Join(list, ", "))
+}
+
+// IsNull is true if a value is missing, which an empty one isn't, or
+// with Not, if it is there.
+type IsNull struct {
+	X   Expr
+	Not bool
+}
+
+func (n *IsNull) Eval(shape geom.Shape) Value {
+	return (n.X.Eval(shape) == nil) != n.Not
+}
+
+func (n *IsNull) String() string {
+	if n.Not {
+		return fmt.Sprintf("(%v is not null)", n.X)
+	}
+	return fmt.Sprintf("(%v is null)", n.X)
+}
+
+// Regexp is true if a regular expression matches anywhere in a value,
+// or with Not, if it doesn't.  Unlike .match(), it needn't match the
+// whole of it, so anchor it with ^ and $ for that.
+type Regexp struct {
+	X       Expr
+	Pattern *regexp.Regexp
+	Not     bool
+}
+
+func (r *Regexp) Eval(shape geom.Shape) Value {
+	return r.Pattern.MatchString(asString(r.X.Eval(shape))) != r.Not
+}
+
+func (r *Regexp) String() string {
+	op := "~"
+	if r.Not {
+		op = "!~"
+	}
+	return fmt.Sprintf("(%v %s %v)", r.X, op, &Literal{r.Pattern.String()})
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// function is one that filters can call.  It takes from min to max
+// arguments, or any number from min if max is -1.
+type function struct {
+	min, max int
+	call     func(shape geom.Shape, args []Value) Value
+}
+
+var functions map[string]function
+
+// geometric are the functions that look at the shape's geometry.
+var geometric = map[string]bool{
+	"area": true, "length": true,
+	"intersects": true, "disjoint": true, "contains": true, "within": true,
+}
+
+func init() {
+	functions = map[string]function{
+		// area is that of a shape's polygons in square metres, and
+		// length that of its lines in metres
+		"area": {0, 0, func(shape geom.Shape, args []Value) Value {
+			return geom.GeodesicArea(geom.GeometryOf(shape))
+		}},
+		"length": {0, 0, func(shape geom.Shape, args []Value) Value {
+			return geom.GeodesicLength(geom.GeometryOf(shape))
+		}},
+		// bbox is a box from the longitude and latitude of its
+		// corners, in degrees
+		"bbox": {4, 4, func(shape geom.Shape, args []Value) Value {
+			var c [4]float64
+			for i, arg := range args {
+				n, ok := asNumber(arg)
+				if !ok {
+					return nil
+				}
+				c[i] = n * math.Pi / 180
+			}
+			return geom.NewBbox(c[0], c[1], c[2], c[3]).Polygon()
+		}},
+		"intersects": predicate(geom.Intersects),
+		"disjoint":   predicate(geom.Disjoint),
+		"contains":   predicate(geom.Contains),
+		"within":     predicate(geom.Within),
+
+		"concat": {0, -1, func(shape geom.Shape, args []Value) Value {
+			var b strings.Builder
+			for _, arg := range args {
+				b.WriteString(asString(arg))
+			}
+			return b.String()
+		}},
+		// coalesce is the first of its arguments that has a value
+		"coalesce": {1, -1, func(shape geom.Shape, args []Value) Value {
+			for _, arg := range args {
+				if arg != nil && arg != "" {
+					return arg
+				}
+			}
+			return nil
+		}},
+		"upper": text(strings.ToUpper),
+		"lower": text(strings.ToLower),
+		"trim":  text(strings.TrimSpace),
+		// substr counts from 1, like SQL, and runs to the end of the
+		// text unless it is given a length
+		"substr": {2, 3, func(shape geom.Shape, args []Value) Value {
+			s := []rune(asString(args[0]))
+			start, ok := asNumber(args[1])
+			if !ok {
+				return nil
+			}
+			from := int(math.Max(start-1, 0))
+			to := len(s)
+			if len(args) == 3 {
+				n, ok := asNumber(args[2])
+				if !ok {
+					return nil
+				}
+				to = from + int(math.Max(n, 0))
+			}
+			if from > len(s) {
+				from = len(s)
+			}
+			if to > len(s) {
+				to = len(s)
+			}
+			return string(s[from:to])
+		}},
+		// round rounds to a number of decimal places, none by default
+		"round": {1, 2, func(shape geom.Shape, args []Value) Value {
+			x, ok := asNumber(args[0])
+			if !ok {
+				return nil
+			}
+			places := 0.0
+			if len(args) == 2 {
+				if places, ok = asNumber(args[1]); !ok {
+					return nil
+				}
+			}
+			scale := math.Pow(10, math.Trunc(places))
+			return math.Round(x*scale) / scale
+		}},
+		"floor": numeric(math.Floor),
+		"ceil":  numeric(math.Ceil),
+		"abs":   numeric(math.Abs),
+		// format_number writes a number with a number of decimal
+		// places, and commas between the thousands
+		"format_number": {1, 2, func(shape geom.Shape, args []Value) Value {
+			x, ok := asNumber(args[0])
+			if !ok {
+				return nil
+			}
+			places := 0.0
+			if len(args) == 2 {
+				if places, ok = asNumber(args[1]); !ok {
+					return nil
+				}
+			}
+			return formatNumber(x, int(math.Max(places, 0)))
+		}},
+		// format_date reads a date, and writes it with a layout of
+		// strftime directives; see formatDate
+		"format_date": {2, 2, func(shape geom.Shape, args []Value) Value {
+			t, ok := parseDate(asString(args[0]))
+			if !ok {
+				return nil
+			}
+			return formatDate(t, asString(args[1]))
+		}},
+	}
+}
+
+// predicate makes a function of a spatial predicate, which tests the
+// shape against its argument.
+func predicate(p func(a, b geom.Geometry) bool) function {
+	return function{1, 1, func(shape geom.Shape, args []Value) Value {
+		g, ok := args[0].(geom.Geometry)
+		return ok && p(geom.GeometryOf(shape), g)
+	}}
+}
+
+// geometryType names the kind of a shape's geometry the way Mapnik
+// does: point, linestring, polygon or collection.
+func geometryType(shape geom.Shape) string {
+	switch shape.(type) {
+	case geom.PointShape, geom.MultiPointShape:
+		return "point"
+	case geom.LineShape, geom.MultiLineShape:
+		return "linestring"
+	case geom.PolygonShape:
+		return "polygon"
+	case geom.CollectionShape:
+		return "collection"
+	}
+	return ""
+}
+
+// text makes a function of one that changes text.
+func text(f func(string) string) function {
+	return function{1, 1, func(shape geom.Shape, args []Value) Value {
+		if args[0] == nil {
+			return nil
+		}
+		return f(asString(args[0]))
+	}}
+}
+
+// numeric makes a function of one of a number.
+func numeric(f func(float64) float64) function {
+	return function{1, 1, func(shape geom.Shape, args []Value) Value {
+		x, ok := asNumber(args[0])
+		if !ok {
+			return nil
+		}
+		return f(x)
+	}}
+}
+
+func formatNumber(x float64, places int) string {
+	s := strconv.FormatFloat(math.Abs(x), 'f', places, 64)
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i:]
+	}
+	var b strings.Builder
+	if x < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(fraction)
+	return b.String()
+}
+
+// dateLayouts are the ways of writing dates that parseDate reads,
+// DBF's among them.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"20060102",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+var strftime = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2",
+	'H': "15", 'I': "03", 'p': "PM", 'M': "04", 'S': "05",
+	'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+}
+
+// formatDate writes a date with a layout in which %Y %y %m %d %e %H %I
+// %p %M %S %b %B %a and %A stand for what they do in strftime, and %%
+// for %.
+func formatDate(t time.Time, layout string) string {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i+1 == len(layout) {
+			b.WriteByte(layout[i])
+			continue
+		}
+		i++
+		if f, ok := strftime[layout[i]]; ok {
+			b.WriteString(t.Format(f))
+		} else if layout[i] == '%' {
+			b.WriteByte('%')
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(layout[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+	"testing"
+)
+
+type polygonShape struct {
+	attrShape
+	polygons geom.MultiPolygon
+}
+
+func (s polygonShape) Bbox() geom.Bbox               { return s.polygons.Bbox() }
+func (s polygonShape) Polygons() geom.MultiPolygon   { return s.polygons }
+func (s polygonShape) Attribute(name string) string  { return s.attrShape[name] }
+func (s polygonShape) Attributes() map[string]string { return s.attrShape }
+
+type lineShape struct {
+	attrShape
+	path geom.Coordinates
+}
+
+func (s lineShape) Bbox() geom.Bbox        { return s.path.Bbox() }
+func (s lineShape) Path() geom.Coordinates { return s.path }
+
+// square is a polygon a hundredth of a degree on each side, with its
+// corner at lng, lat in degrees.
+func square(lng, lat float64) geom.MultiPolygon {
+	d := math.Pi / 180
+	x, y, s := lng*d, lat*d, 0.01*d
+	return geom.MultiPolygon{{{{x, y}, {x + s, y}, {x + s, y + s}, {x, y + s}, {x, y}}}}
+}
+
+func TestSpatialFilters(t *testing.T) {
+	// about 1.24km square, at the equator
+	block := polygonShape{attrShape{"kind": "park"}, square(0, 0)}
+	far := polygonShape{attrShape{"kind": "park"}, square(10, 10)}
+	road := lineShape{attrShape{"kind": "road"}, geom.Coordinates{{0, 0}, {0.001, 0}}}
+	tests := []struct {
+		filter string
+		shape  geom.Shape
+		want   bool
+	}{
+		{"geometry_type = polygon", block, true},
+		{"geometry_type = polygon", road, false},
+		{"[mapnik::geometry_type] = linestring and kind = road", road, true},
+		{"area() > 1e6 and area() < 2e6", block, true},
+		{"area() > 0", road, false},
+		{"length() > 6000 and length() < 7000", road, true},
+		{"intersects(bbox(-1, -1, 1, 1))", block, true},
+		{"intersects(bbox(-1, -1, 1, 1))", far, false},
+		{"within(bbox(-1, -1, 1, 1)) and not disjoint(bbox(0.005, 0.005, 1, 1))", block, true},
+		{"contains(bbox(0.001, 0.001, 0.002, 0.002))", block, true},
+		{"CONTAINS(bbox(5, 5, 6, 6)) or kind contains ar", block, true},
+	}
+	for _, test := range tests {
+		if got := applies(test.filter, test.shape); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+
+	f, _ := Compile("geometry_type = polygon and intersects(bbox(0, 0, 1, 1)) and kind = park")
+	if fields := f.Fields(); len(fields) != 1 || fields[0] != "kind" {
+		t.Errorf("expected only kind to be read from the source, got %v", fields)
+	}
+
+	errors := []struct {
+		src string
+		col int
+	}{
+		{"frob() > 1", 1},
+		{"area(1) > 1", 1},
+		{"intersects(bbox(1, 2, 3)", 12},
+		{"intersects(bbox(1, 2, 3, 4) x", 29},
+	}
+	for _, test := range errors {
+		_, err := Parse(test.src)
+		if serr, ok := err.(*SyntaxError); !ok || serr.Col != test.col {
+			t.Errorf("%q: expected a syntax error at column %d, got %v", test.src, test.col, err)
+		}
+	}
+}
+
+func TestValueFunctions(t *testing.T) {
+	shape := attrShape{
+		"name": "Main Street", "ref": "B 12", "name_en": "", "ele": "1234.56",
+		"pop": "-1234567.891", "opened": "20150314", "padded": "  x  ",
+	}
+	tests := []struct {
+		expr, want string
+	}{
+		{"concat(name, ' (', ref, ')')", "Main Street (B 12)"},
+		{"concat()", ""},
+		{"upper(name)", "MAIN STREET"},
+		{"lower([ref])", "b 12"},
+		{"coalesce(name_en, missing, name)", "Main Street"},
+		{"coalesce(name_en)", ""},
+		{"concat('[', trim(padded), ']')", "[x]"},
+		{"substr(name, 6)", "Street"},
+		{"substr(name, 1, 4)", "Main"},
+		{"substr(name, 20, 4)", ""},
+		{"round(ele)", "1235"},
+		{"round(ele, 1)", "1234.6"},
+		{"floor(ele)", "1234"},
+		{"ceil(ele)", "1235"},
+		{"abs(pop)", "1234567.891"},
+		{"round(name)", ""},
+		{"format_number(pop, 2)", "-1,234,567.89"},
+		{"format_number(ele)", "1,235"},
+		{"format_number(0.4)", "0"},
+		{"format_number(-0.4)", "0"},
+		{"format_date(opened, '%e %B %Y')", "14 March 2015"},
+		{"format_date('2015-03-14T09:26:53Z', '%Y-%m-%d %H:%M %% %q')", "2015-03-14 09:26 % %q"},
+		{"format_date(name, '%Y')", ""},
+		{"upper(substr(concat(ref, name), 1, 1))", "B"},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Text(e, shape); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.expr, test.want, got)
+		}
+	}
+
+	// filters call the same functions
+	if !applies("upper(name) = 'MAIN STREET' and round(ele) >= 1235", shape) {
+		t.Error("expected the filter to apply")
+	}
+	if _, err := Parse("upper(name, ref)"); err == nil {
+		t.Error("expected too many arguments to be an error")
+	}
+}
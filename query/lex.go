@@ -0,0 +1,204 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokField
+	tokVariable
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokDot
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	col  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokField:
+		return "[" + t.text + "]"
+	case tokVariable:
+		return "@" + t.text
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// keyword reports whether the token is the given keyword, which may be
+// in any case.
+func (t token) keyword(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// is reports whether the token is one of the given keywords or
+// operators.
+func (t token) is(alternatives ...string) bool {
+	for _, a := range alternatives {
+		if t.keyword(a) || t.kind == tokOp && t.text == a {
+			return true
+		}
+	}
+	return false
+}
+
+// SyntaxError is returned for a filter that can't be parsed.  Col is
+// the column, counting from 1, where the problem was found.
+type SyntaxError struct {
+	Col int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Col, e.Msg)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':'
+}
+
+var number = regexp.MustCompile(`^-?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?`)
+
+var operators = []string{"<=", ">=", "!=", "<>", "==", "&&", "||", "!~", "=", "<", ">", "!", "*", "~"}
+
+// lex splits a filter into tokens.  Strings are quoted with ' or " and
+// may escape the quote, a backslash, or \n and \t with a backslash;
+// other escapes, like the \d of a regular expression, are left as is.
+// Fields may be put in brackets, as in Mapnik, which lets their names
+// hold any character but ].
+func lex(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r, col := runes[i], i+1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", col})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", col})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", col})
+			i++
+		case r == '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, &SyntaxError{col, "unterminated field"}
+			}
+			tokens = append(tokens, token{tokField, string(runes[i+1 : j]), col})
+			i = j + 1
+		case r == '\'' || r == '"':
+			text, n, err := lexString(runes[i:], col)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokString, text, col})
+			i += n
+		case number.MatchString(string(runes[i:])) && !numberInWord(runes, i):
+			n := len([]rune(number.FindString(string(runes[i:]))))
+			tokens = append(tokens, token{tokNumber, string(runes[i : i+n]), col})
+			i += n
+		case r == '.':
+			tokens = append(tokens, token{tokDot, ".", col})
+			i++
+		case r == '@':
+			j := i + 1
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, &SyntaxError{col, "expected a variable name after @"}
+			}
+			tokens = append(tokens, token{tokVariable, string(runes[i+1 : j]), col})
+			i = j
+		case isWordRune(r):
+			j := i
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, string(runes[i:j]), col})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &SyntaxError{col, fmt.Sprintf("unexpected %q", r)}
+			}
+			tokens = append(tokens, token{tokOp, op, col})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(runes) + 1}), nil
+}
+
+// numberInWord reports whether the number at runes[i] runs on into a
+// word, like 4th or 10m, which is then read as a word.
+func numberInWord(runes []rune, i int) bool {
+	n := len([]rune(number.FindString(string(runes[i:]))))
+	return i+n < len(runes) && isWordRune(runes[i+n])
+}
+
+// lexString reads the quoted string at the start of runes, and returns
+// its text and how many runes it took up.
+func lexString(runes []rune, col int) (string, int, error) {
+	quote := runes[0]
+	var text []rune
+	for i := 1; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case quote:
+			return string(text), i + 1, nil
+		case '\\':
+			i++
+			if i == len(runes) {
+				break
+			}
+			switch e := runes[i]; e {
+			case 'n':
+				text = append(text, '\n')
+			case 't':
+				text = append(text, '\t')
+			case '\\', '\'', '"':
+				text = append(text, e)
+			default:
+				// kept as they are, for regular expressions
+				text = append(text, '\\', e)
+			}
+		default:
+			text = append(text, r)
+		}
+	}
+	return "", 0, &SyntaxError{col, "unterminated string"}
+}
@@ -0,0 +1,365 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var comparisons = map[string]Op{
+	"=": OpEq, "==": OpEq, "!=": OpNe, "<>": OpNe,
+	"<": OpLt, "<=": OpLe, ">": OpGt, ">=": OpGe,
+	"eq": OpEq, "ne": OpNe, "neq": OpNe,
+	"lt": OpLt, "le": OpLe, "gt": OpGt, "ge": OpGe,
+	"contains": OpContains,
+}
+
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "in": true, "is": true}
+
+// Parse parses a filter into an expression.  From loosest to tightest,
+// a filter is built of "or", "and", "not", and comparisons with = != <
+// <= > >= or contains, grouped with parentheses where needed.  A bare
+// word is an attribute on the left of a comparison and plain text on
+// the right, so "highway = primary" compares the highway attribute with
+// the text "primary"; on its own, it is true if the attribute isn't
+// empty.  Text with spaces or keywords in it can be quoted with ' or ".
+// Numbers like 4, -1.5 and 1e6 are numeric; see Binary for how they
+// compare.
+//
+// Mapnik's filters parse too: fields may be written in brackets, as in
+// "[highway] = 'primary'", and the operators may be written && || ! eq
+// neq lt le gt ge.  Any value can be followed by .match('regexp'), which
+// is true if the whole of it matches, or by .replace('regexp', 'text'),
+// which replaces every match; see regexp.Regexp.Expand for the $1s that
+// text may hold.
+//
+// "x in (a, b, c)" is true if x equals one of the list, and "x not in
+// (...)" if it equals none.  "x is null" is true if the shape doesn't
+// have the attribute x, which is not the same as having it empty, and
+// "x is not null" if it does; elsewhere, a missing attribute is empty.
+// "x ~ 'regexp'" is true if the regular expression matches somewhere
+// in x, and "x !~ 'regexp'" if it doesn't.
+//
+// Variables are written @name, and have the values given to Bind; the
+// renderer gives @zoom and @scale_denominator.
+//
+// geometry_type, or Mapnik's [mapnik::geometry_type], is the kind of
+// the shape: point, linestring, polygon or collection.  Functions of
+// the shape itself are area(), in square metres, and length(), in
+// metres; intersects(g), disjoint(g), contains(g) and within(g), which
+// test it against a geometry; and bbox(minx, miny, maxx, maxy), which
+// is the geometry of a box with its corners in degrees.
+//
+// Other functions work on values: concat(a, ...), coalesce(a, ...),
+// which is the first that isn't empty, upper(s), lower(s), trim(s),
+// substr(s, from[, length]), round(x[, places]), floor(x), ceil(x),
+// abs(x), format_number(x[, places]) and format_date(date, layout),
+// whose layout takes strftime's directives.  A function that is given
+// something it can't work with has no value.  Labels are written in
+// the same language, so that "concat(name, ' (', ref, ')')" labels a
+// road with its name and number.
+func Parse(src string) (Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	return &SyntaxError{t.col, fmt.Sprintf("unexpected %v", t)}
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	for err == nil && p.peek().is("or", "||") {
+		p.next()
+		var right Expr
+		if right, err = p.and(); err == nil {
+			left = &Binary{OpOr, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	for err == nil && p.peek().is("and", "&&") {
+		p.next()
+		var right Expr
+		if right, err = p.not(); err == nil {
+			left = &Binary{OpAnd, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.peek().is("not", "!") {
+		p.next()
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	left, err := p.operand(false)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.keyword("is"):
+		return p.isNull(left)
+	case t.keyword("in"):
+		p.next()
+		return p.in(left, false)
+	case t.keyword("not") && p.tokens[p.pos+1].keyword("in"):
+		p.next()
+		p.next()
+		return p.in(left, true)
+	case t.is("~", "!~"):
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, &SyntaxError{pattern.col, fmt.Sprintf("expected a regular expression in quotes, found %v", pattern)}
+		}
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, &SyntaxError{pattern.col, err.Error()}
+		}
+		return &Regexp{left, re, t.text == "!~"}, nil
+	case t.kind != tokOp && t.kind != tokWord:
+		return left, nil
+	}
+	op, ok := comparisons[strings.ToLower(t.text)]
+	if !ok || t.kind == tokWord && keywords[strings.ToLower(t.text)] {
+		return left, nil
+	}
+	p.next()
+	right, err := p.operand(true)
+	if err != nil {
+		return nil, err
+	}
+	return &Binary{op, left, right}, nil
+}
+
+// isNull parses IS [NOT] NULL after x.
+func (p *parser) isNull(x Expr) (Expr, error) {
+	p.next()
+	not := p.peek().keyword("not")
+	if not {
+		p.next()
+	}
+	if t := p.next(); !t.keyword("null") {
+		return nil, &SyntaxError{t.col, fmt.Sprintf("expected NULL, found %v", t)}
+	}
+	return &IsNull{x, not}, nil
+}
+
+// in parses the list of an IN after x.  Bare words in it are text, as
+// on the right of a comparison.
+func (p *parser) in(x Expr, not bool) (Expr, error) {
+	if t := p.next(); t.kind != tokLParen {
+		return nil, &SyntaxError{t.col, fmt.Sprintf("expected ( to start the list, found %v", t)}
+	}
+	var list []Expr
+	for {
+		item, err := p.operand(true)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+		t := p.next()
+		if t.kind == tokRParen {
+			return &In{x, list, not}, nil
+		}
+		if t.kind != tokComma {
+			return nil, &SyntaxError{t.col, fmt.Sprintf("expected , or ) in the list, found %v", t)}
+		}
+	}
+}
+
+// operand parses one side of a comparison.  Bare words are attributes
+// on the left and text on the right.
+func (p *parser) operand(right bool) (Expr, error) {
+	var e Expr
+	switch t := p.next(); {
+	case t.kind == tokLParen:
+		var err error
+		if e, err = p.or(); err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &SyntaxError{c.col, fmt.Sprintf("expected ) to close the ( at column %d, found %v", t.col, c)}
+		}
+	case t.kind == tokString:
+		e = &Literal{t.text}
+	case t.kind == tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{t.col, fmt.Sprintf("bad number %q", t.text)}
+		}
+		e = &Literal{n}
+	case t.kind == tokField && isGeometryType(t.text):
+		e = &GeometryType{}
+	case t.kind == tokField:
+		e = &Field{t.text}
+	case t.kind == tokWord && p.peek().kind == tokLParen:
+		var err error
+		if e, err = p.call(t); err != nil {
+			return nil, err
+		}
+	case t.kind == tokVariable:
+		e = &Variable{t.text}
+	case t.kind == tokWord && !right && isGeometryType(t.text):
+		e = &GeometryType{}
+	case t.kind == tokWord && !isKeyword(t):
+		if right {
+			e = &Literal{t.text}
+		} else {
+			e = &Field{t.text}
+		}
+	default:
+		return nil, p.unexpected(t)
+	}
+	for p.peek().kind == tokDot {
+		var err error
+		if e, err = p.method(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// call parses a call of the function named by t.
+func (p *parser) call(t token) (Expr, error) {
+	name := strings.ToLower(t.text)
+	fn, ok := functions[name]
+	if !ok {
+		return nil, &SyntaxError{t.col, fmt.Sprintf("unknown function %s", t.text)}
+	}
+	p.next()
+	var args []Expr
+	if p.peek().kind == tokRParen {
+		p.next()
+	} else {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			c := p.next()
+			if c.kind == tokRParen {
+				break
+			}
+			if c.kind != tokComma {
+				return nil, &SyntaxError{c.col, fmt.Sprintf("expected , or ) in the call of %s, found %v", t.text, c)}
+			}
+		}
+	}
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, &SyntaxError{t.col, fmt.Sprintf("%s takes %s, not %d", t.text, arity(fn), len(args))}
+	}
+	return &Call{name, args, fn}, nil
+}
+
+func arity(fn function) string {
+	switch {
+	case fn.max < 0:
+		return fmt.Sprintf("at least %d arguments", fn.min)
+	case fn.min == fn.max:
+		return fmt.Sprintf("%d arguments", fn.min)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.min, fn.max)
+}
+
+// isGeometryType reports whether a field is the kind of the shape's
+// geometry rather than one of its attributes.
+func isGeometryType(name string) bool {
+	return name == "geometry_type" || name == "mapnik::geometry_type"
+}
+
+// method parses a .match() or .replace() on e.
+func (p *parser) method(e Expr) (Expr, error) {
+	p.next()
+	name := p.next()
+	if name.kind != tokWord {
+		return nil, p.unexpected(name)
+	}
+	var args []token
+	if t := p.next(); t.kind != tokLParen {
+		return nil, p.unexpected(t)
+	}
+	for {
+		t := p.next()
+		if t.kind != tokString {
+			return nil, &SyntaxError{t.col, fmt.Sprintf("expected a string, found %v", t)}
+		}
+		args = append(args, t)
+		if t = p.next(); t.kind == tokRParen {
+			break
+		} else if t.kind != tokComma {
+			return nil, p.unexpected(t)
+		}
+	}
+	arity := map[string]int{"match": 1, "replace": 2}[name.text]
+	if arity == 0 {
+		return nil, &SyntaxError{name.col, fmt.Sprintf("unknown method %s", name.text)}
+	}
+	if len(args) != arity {
+		return nil, &SyntaxError{name.col, fmt.Sprintf("%s takes %d arguments, not %d", name.text, arity, len(args))}
+	}
+	pattern := args[0].text
+	if name.text == "match" {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &SyntaxError{args[0].col, err.Error()}
+	}
+	if name.text == "match" {
+		return &Match{e, re}, nil
+	}
+	return &Replace{e, re, args[1].text}, nil
+}
+
+func isKeyword(t token) bool {
+	_, comparison := comparisons[strings.ToLower(t.text)]
+	return keywords[strings.ToLower(t.text)] || comparison
+}
@@ -0,0 +1,390 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"strings"
+	"testing"
+)
+
+type attrShape map[string]string
+
+func (s attrShape) Bbox() geom.Bbox              { return geom.NewBbox(0, 0, 0, 0) }
+func (s attrShape) Attribute(name string) string { return s[name] }
+
+// applies compiles and applies a filter, which applies to nothing if it
+// doesn't compile.
+func applies(src string, shape geom.Shape) bool {
+	f, err := Compile(src)
+	return err == nil && f.Applies(shape)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"highway = primary", "(highway = 'primary')"},
+		{"a = 1 or b = 2 and c = 3", "((a = 1) or ((b = 2) and (c = 3)))"},
+		{"(a = 1 or b = 2) and c", "(((a = 1) or (b = 2)) and c)"},
+		{"not a = 1 AND NOT b", "((not (a = 1)) and (not b))"},
+		{"pop > -1.5e6 and ref = 4th", "((pop > -1500000) and (ref = '4th'))"},
+		{"name = 'Rue d\\'Or and more'", "(name = 'Rue d\\'Or and more')"},
+		{`name contains "a\tb"`, "(name contains 'a\tb')"},
+		{"a <> b", "(a != 'b')"},
+		{"addr:street >= 'M'", "(addr:street >= 'M')"},
+		{"[road name] = [ref] && ![x].match('a+')", "(([road name] = ref) and (not x.match('a+')))"},
+		{`[a].replace('\s+', ' ') neq 'b'`, `(a.replace('\\s+', ' ') != 'b')`},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		if got := e.String(); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.src, test.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		col int
+	}{
+		{"", 1},
+		{"a = ", 5},
+		{"a = 'open", 5},
+		{"(a = b", 7},
+		{"a = b)", 6},
+		{"a and or b", 7},
+		{"a & b", 3},
+		{"a > -b", 5},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: expected a syntax error, got %v", test.src, err)
+			continue
+		}
+		if serr.Col != test.col {
+			t.Errorf("%q: expected the error at column %d, got %v", test.src, test.col, serr)
+		}
+	}
+}
+
+func TestFilterApplies(t *testing.T) {
+	shape := attrShape{"highway": "primary", "name": "Main Street", "ref": "B"}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"", true},
+		{"highway = primary", true},
+		{"highway != primary", false},
+		{"name = 'Main Street'", true},
+		{"name contains Street and not ref = A", true},
+		{"highway = secondary or (ref > A and ref < C)", true},
+		{"missing", false},
+		{"not missing and name", true},
+		{"highway = 'primary' and", false},
+	}
+	for _, test := range tests {
+		if got := applies(test.filter, shape); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+}
+
+func TestNumericComparison(t *testing.T) {
+	shape := attrShape{"population": "1500000", "lanes": "10", "width": " 7.5", "ref": "A1", "name": "Nan", "code": "Inf"}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"population > 1000000", true},
+		{"population > 1e7", false},
+		{"lanes >= 4", true},
+		// text that holds a number still compares as one
+		{"lanes >= '4'", true},
+		{"lanes = 10.0", true},
+		{"width < 8", true},
+		{"ref > 0", false},
+		{"ref != 0", true},
+		{"missing = 0", false},
+		{"ref > A", true},
+		// text that ParseFloat would take for NaN or infinity
+		{"name = 'Nan'", true},
+		{"name != 'nan' and name != 'NaN'", true},
+		{"code > 1000", false},
+		{"code = 'Inf' and code != 'inf'", true},
+	}
+	for _, test := range tests {
+		if got := applies(test.filter, shape); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+}
+
+func TestMapnikFilters(t *testing.T) {
+	shape := attrShape{"highway": "primary", "name": "", "type": "abc", "pop": "250", "road name": "A 1"}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"[highway] = 'primary'", true},
+		{"[name] != ''", false},
+		{"[type].match('^a')", false},
+		{"[type].match('a.*')", true},
+		{"[pop] > 100 && ![name]", true},
+		{"[pop] gt 300 || [highway] eq 'primary'", true},
+		{"[type].replace('b', 'x') = 'axc'", true},
+		{"[type].replace('(a)(b)', '$2$1').match('bac')", true},
+		{"[road name] = 'A 1'", true},
+		{"([highway] = 'primary') and not ([type] neq 'abc')", true},
+	}
+	for _, test := range tests {
+		if got := applies(test.filter, shape); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+
+	errors := []struct {
+		src string
+		col int
+	}{
+		{"[highway = 'a'", 1},
+		{"[type].frob('a')", 8},
+		{"[type].match('(')", 14},
+		{"[type].match([a])", 14},
+		{"[type].replace('a')", 8},
+	}
+	for _, test := range errors {
+		_, err := Parse(test.src)
+		if serr, ok := err.(*SyntaxError); !ok || serr.Col != test.col {
+			t.Errorf("%q: expected a syntax error at column %d, got %v", test.src, test.col, err)
+		}
+	}
+}
+
+const benchFilter = "[highway] = 'primary' or ([highway] = 'secondary' and lanes >= 4) or name.match('A[0-9]+')"
+
+var benchShape = attrShape{"highway": "residential", "lanes": "2", "name": "Elm Street"}
+
+// BenchmarkParseAndApply parses the filter again for every shape.
+func BenchmarkParseAndApply(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if f, err := Compile(benchFilter); err != nil || f.Applies(benchShape) {
+			b.Fatal("expected the filter not to apply")
+		}
+	}
+}
+
+func BenchmarkCompiledApply(b *testing.B) {
+	f, err := Compile(benchFilter)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if f.Applies(benchShape) {
+			b.Fatal("expected the filter not to apply")
+		}
+	}
+}
+
+// splitFilter is one that the old evaluator below understands, which
+// only had =, contains, and and or.
+const splitFilter = "highway = primary or highway = secondary or name contains Avenue"
+
+// splitApplies is how filters were applied before they were compiled,
+// splitting the filter's text again for every shape.
+func splitApplies(filter string, shape geom.Shape) bool {
+	if filter == "" {
+		return true
+	}
+	matches := false
+	for i, and := range strings.Split(filter, " and ") {
+		does := false
+		for _, part := range strings.Split(and, " or ") {
+			var name string
+			if strings.Contains(part, " = ") {
+				parts := strings.Split(part, " = ")
+				fmt.Sscanf(parts[0], "%s", &name)
+				does = shape.Attribute(name) == strings.TrimSpace(parts[1])
+			} else if strings.Contains(part, " contains ") {
+				parts := strings.Split(part, " contains ")
+				fmt.Sscanf(parts[0], "%s", &name)
+				does = strings.Contains(shape.Attribute(name), strings.TrimSpace(parts[1]))
+			} else {
+				fmt.Sscanf(part, "%s", &name)
+				does = shape.Attribute(name) != ""
+			}
+			if does {
+				break
+			}
+		}
+		if i == 0 {
+			matches = does
+		} else {
+			matches = does && matches
+		}
+	}
+	return matches
+}
+
+func BenchmarkSplitApply(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if splitApplies(splitFilter, benchShape) {
+			b.Fatal("expected the filter not to apply")
+		}
+	}
+}
+
+func BenchmarkCompiledSplitApply(b *testing.B) {
+	f, err := Compile(splitFilter)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if f.Applies(benchShape) {
+			b.Fatal("expected the filter not to apply")
+		}
+	}
+}
+
+func TestPushdown(t *testing.T) {
+	primary, _ := Compile("[highway] = 'primary' and lanes > 2")
+	named, _ := Compile("name.match('A.*') or highway = 'trunk'")
+	any := Any(primary, named)
+	if got := any.String(); got != "(((highway = 'primary') and (lanes > 2)) or (name.match('A.*') or (highway = 'trunk')))" {
+		t.Errorf("unexpected union %s", got)
+	}
+	if Any(primary, Filter{}).Expr != nil || Any().Expr != nil {
+		t.Error("expected a union with an empty filter to apply to everything")
+	}
+
+	q := NewQuery(geom.NewBbox(0, 0, 1, 1)).Select("ref").Where(any).Include("ref", "label")
+	if got := fmt.Sprint(q.Sel.Fields); got != "[ref highway lanes name label]" {
+		t.Errorf("unexpected selection %s", got)
+	}
+	if !q.Matches(attrShape{"name": "Avenue"}) || q.Matches(attrShape{"highway": "primary", "lanes": "1"}) {
+		t.Error("expected the query to match only the shapes one of the filters applies to")
+	}
+	if fields, geometric := q.Uses(); fmt.Sprint(fields) != "[highway lanes name]" || geometric {
+		t.Errorf("unexpected use of %v, geometric %v", fields, geometric)
+	}
+	shaped, _ := Compile("area() > 10 or geometry_type = point")
+	if _, geometric := q.Where(shaped).Uses(); !geometric {
+		t.Error("expected a query with a filter on the geometry to use it")
+	}
+}
+
+func TestBind(t *testing.T) {
+	f, err := Compile("@zoom >= 12 and highway = primary or @scale_denominator < 5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape := attrShape{"highway": "primary"}
+	if f.Applies(shape) {
+		t.Error("expected an unbound filter not to apply")
+	}
+	if !f.Bind(map[string]Value{"zoom": 12.0}).Applies(shape) {
+		t.Error("expected the filter to apply at zoom 12")
+	}
+	bound := f.Bind(map[string]Value{"zoom": 11.0, "scale_denominator": 4000.0})
+	if got := bound.String(); got != "(((11 >= 12) and (highway = 'primary')) or (4000 < 5000))" {
+		t.Errorf("unexpected bound filter %s", got)
+	}
+	if f.String() != "(((@zoom >= 12) and (highway = 'primary')) or (@scale_denominator < 5000))" {
+		t.Errorf("expected binding to leave the filter alone, got %s", f)
+	}
+	if _, err := Parse("@ = 1"); err == nil {
+		t.Error("expected a variable without a name to be an error")
+	}
+}
+
+// listedShape lists its attributes, so that it can tell an empty one
+// from one it doesn't have.
+type listedShape map[string]string
+
+func (s listedShape) Bbox() geom.Bbox               { return geom.NewBbox(0, 0, 0, 0) }
+func (s listedShape) Attribute(name string) string  { return s[name] }
+func (s listedShape) Attributes() map[string]string { return s }
+
+func TestInNullAndRegexp(t *testing.T) {
+	shape := listedShape{"highway": "secondary", "ref": "A14", "name": "", "lanes": "4"}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"highway in (primary, secondary, 'tertiary')", true},
+		{"highway in ('primary')", false},
+		{"highway not in (primary, trunk)", true},
+		{"not highway in (secondary)", false},
+		{"lanes in (2, 4.0)", true},
+		{"geometry_type in (point, polygon)", false},
+		{"name is null", false},
+		{"name is not null and name = ''", true},
+		{"missing is null", true},
+		{"missing IS NOT NULL", false},
+		{"upper(missing) is null and coalesce(missing, name) is null", true},
+		{"missing = ''", true},
+		{"ref ~ '^A[0-9]+'", true},
+		{"ref ~ '1'", true},
+		{"ref ~ '^[0-9]'", false},
+		{"ref !~ '^B' and highway ~ 'second'", true},
+		{"[ref] ~ 'a14' or ref ~ '(?i)a14'", true},
+	}
+	for _, test := range tests {
+		if got := applies(test.filter, shape); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+
+	// shapes that can't list their attributes have those that aren't
+	// empty
+	if !applies("name is null and ref is not null", attrShape{"name": "", "ref": "A1"}) {
+		t.Error("expected an empty attribute to be missing")
+	}
+
+	printed := []struct {
+		src, want string
+	}{
+		{"a in (x, 'y', 1)", "(a in ('x', 'y', 1))"},
+		{"a not in (x) and b is not null", "((a not in ('x')) and (b is not null))"},
+		{"a ~ '\\d+' or a !~ 'x'", "((a ~ '\\\\d+') or (a !~ 'x'))"},
+	}
+	for _, test := range printed {
+		e, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+		} else if got := e.String(); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.src, test.want, got)
+		}
+	}
+
+	errors := []struct {
+		src string
+		col int
+	}{
+		{"a in x", 6},
+		{"a in (x y)", 9},
+		{"a in ()", 7},
+		{"a is empty", 6},
+		{"a ~ b", 5},
+		{"a ~ '('", 5},
+	}
+	for _, test := range errors {
+		_, err := Parse(test.src)
+		if serr, ok := err.(*SyntaxError); !ok || serr.Col != test.col {
+			t.Errorf("%q: expected a syntax error at column %d, got %v", test.src, test.col, err)
+		}
+	}
+}
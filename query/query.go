@@ -7,17 +7,20 @@ package query
 import (
 	"fmt"
 	"github.com/samlecuyer/ecumene/geom"
-	"regexp"
 	"strings"
 )
 
 type Assertion func(string) bool
 
-// TODO: I need to find a way to query ahead of time
+// Query asks a source for the shapes in Bounds that meet every one of
+// Filters, with the attributes in Sel.  Sources may skip the records
+// that fail the filters before they build shapes out of them, and may
+// stop once they have sent Limit shapes, if it isn't 0.
 type Query struct {
 	Bounds  geom.Bbox
 	Filters []Filter
 	Sel     *Select
+	Limit   int
 }
 
 func NewQuery(bb geom.Bbox) *Query {
@@ -29,71 +32,185 @@ func (q *Query) Bounded(bb geom.Bbox) *Query {
 	return q
 }
 
-type Select struct {
-	Fields []string `xml:"fields,attr"`
-	// Table string `xml:"table,attr"`
+// Where adds a filter that shapes must meet, and the fields it uses to
+// the selection.
+func (q *Query) Where(f Filter) *Query {
+	if f.Expr != nil {
+		q.Filters = append(q.Filters, f)
+		q.Include(f.Fields()...)
+	}
+	return q
 }
 
-// This is possibly the worst sql parser ever.
-func (q *Query) Select(selstmt string) *Query {
-	r, err := regexp.Compile(`^([a-zA-Z\,]+)`)
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		w := r.FindAllStringSubmatch(selstmt, -1)
-		if len(w) == 1 && len(w[0]) == 2 {
-			q.Sel = &Select{strings.Split(w[0][1], ",")}
+// Include adds fields to the selection, unless they are there already.
+func (q *Query) Include(fields ...string) *Query {
+	if len(fields) == 0 {
+		return q
+	}
+	if q.Sel == nil {
+		q.Sel = new(Select)
+	}
+	for _, field := range fields {
+		if !q.Sel.Has(field) {
+			q.Sel.Fields = append(q.Sel.Fields, field)
 		}
 	}
 	return q
 }
 
-func doesExpr(part string, shape geom.Shape) bool {
-	var name string
-	var value string
-
-	if strings.Contains(part, " = ") {
-		parts := strings.Split(part, " = ")
-		fmt.Sscanf(parts[0], "%s", &name)
-		value = strings.TrimSpace(parts[1])
-		return shape.Attribute(name) == value
-	} else if strings.Contains(part, " contains ") {
-		parts := strings.Split(part, " contains ")
-		fmt.Sscanf(parts[0], "%s", &name)
-		value = strings.TrimSpace(parts[1])
-		attr := shape.Attribute(name)
-		return strings.Contains(attr, value)
-	} else {
-		fmt.Sscanf(part, "%s", &name)
-		return shape.Attribute(name) != ""
+// With sets the statement the query runs.  The statement is copied, so
+// that Include doesn't change it.
+func (q *Query) With(sel *Select) *Query {
+	if sel != nil {
+		copied := *sel
+		copied.Fields = append([]string(nil), sel.Fields...)
+		q.Sel = &copied
+	}
+	return q
+}
+
+// Select parses a statement and sets it as the one the query runs.  A
+// statement that can't be parsed is reported and ignored.
+func (q *Query) Select(stmt string) *Query {
+	sel, err := ParseSelect(stmt)
+	if err != nil {
+		fmt.Println(err)
+		return q
 	}
-	return false
+	return q.With(sel)
 }
 
-func doesOr(filter string, shape geom.Shape) bool {
-	for _, part := range strings.Split(string(filter), " or ") {
-		if doesExpr(part, shape) {
-			return true
+// Matches reports whether a shape meets the WHERE of the query's
+// statement and all of its filters.
+func (q *Query) Matches(shape geom.Shape) bool {
+	if q.Sel != nil && !q.Sel.Where.Applies(shape) {
+		return false
+	}
+	for _, f := range q.Filters {
+		if !f.Applies(shape) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
-func doesAnd(filter Filter, shape geom.Shape) bool {
-	matches := false
-	for i, part := range strings.Split(string(filter), " and ") {
-		does := doesOr(part, shape)
-		if i == 0 {
-			matches = does
-		} else {
-			matches = does && matches
+// Uses lists the attributes that the query's statement and filters
+// test, and reports whether they look at the geometry of shapes too.
+// A source can apply a query that doesn't to a record's attributes
+// before it reads the geometry.
+func (q *Query) Uses() (fields []string, geometric bool) {
+	conditions := q.Filters
+	if q.Sel != nil {
+		conditions = append([]Filter{q.Sel.Where}, conditions...)
+	}
+	var all Expr
+	for _, f := range conditions {
+		switch {
+		case f.Expr == nil:
+		case all == nil:
+			all = f.Expr
+		default:
+			all = &Binary{OpAnd, all, f.Expr}
 		}
 	}
-	return matches
+	return Fields(all), Filter{all}.Geometric()
+}
+
+// Filter is a compiled condition written in the filter language; see
+// Parse.  The zero Filter applies to every shape.
+type Filter struct {
+	Expr Expr
 }
 
-type Filter string
+// Compile parses a filter once, so that it can be applied to many
+// shapes.  The empty filter applies to every shape.
+func Compile(src string) (Filter, error) {
+	if strings.TrimSpace(src) == "" {
+		return Filter{}, nil
+	}
+	e, err := Parse(src)
+	return Filter{e}, err
+}
 
+// Any is a filter that applies where any of filters does.  If one of
+// them applies to every shape, or there are none, so does Any.
+func Any(filters ...Filter) Filter {
+	var any Expr
+	for _, f := range filters {
+		switch {
+		case f.Expr == nil:
+			return Filter{}
+		case any == nil:
+			any = f.Expr
+		default:
+			any = &Binary{OpOr, any, f.Expr}
+		}
+	}
+	return Filter{any}
+}
+
+// Bind gives variables their values, and returns the filter with them
+// in place.  Variables not in vars are left unbound.
+func (f Filter) Bind(vars map[string]Value) Filter {
+	return Filter{rewrite(f.Expr, func(e Expr) Expr {
+		if v, ok := e.(*Variable); ok {
+			if value, ok := vars[v.Name]; ok {
+				return &Literal{value}
+			}
+		}
+		return e
+	})}
+}
+
+// Fields lists the attributes the filter uses.
+func (f Filter) Fields() []string {
+	return Fields(f.Expr)
+}
+
+// Geometric reports whether the filter looks at the geometry of shapes,
+// with geometry_type or one of the functions of the shape.
+func (f Filter) Geometric() bool {
+	found := false
+	walk(f.Expr, func(e Expr) {
+		switch e := e.(type) {
+		case *GeometryType:
+			found = true
+		case *Call:
+			found = found || geometric[e.Name]
+		}
+	})
+	return found
+}
+
+// Fields lists the attributes an expression uses.
+func Fields(e Expr) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	walk(e, func(e Expr) {
+		if field, ok := e.(*Field); ok && !seen[field.Name] {
+			seen[field.Name] = true
+			fields = append(fields, field.Name)
+		}
+	})
+	return fields
+}
+
+// Text is the value of an expression for a shape, written as text.
+func Text(e Expr, shape geom.Shape) string {
+	if e == nil {
+		return ""
+	}
+	return asString(e.Eval(shape))
+}
+
+// Applies reports whether the shape meets the filter.
 func (f Filter) Applies(shape geom.Shape) bool {
-	return f == "" || doesAnd(f, shape)
+	return f.Expr == nil || Truthy(f.Expr.Eval(shape))
+}
+
+func (f Filter) String() string {
+	if f.Expr == nil {
+		return ""
+	}
+	return f.Expr.String()
 }
@@ -0,0 +1,263 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column is one of the columns a statement selects: an expression, and
+// the name it goes by.
+type Column struct {
+	Name string
+	Expr Expr
+}
+
+// Order is one of the keys of an ORDER BY.
+type Order struct {
+	Expr Expr
+	Desc bool
+}
+
+// Select is a parsed statement; see ParseSelect.
+type Select struct {
+	// Fields are the attributes to read from the source, and All
+	// reads every one of them.
+	Fields []string `xml:"fields,attr"`
+	All    bool
+	// Columns are the attributes of the shapes that come out, or nil
+	// for all of those of the source.  The attributes of the source
+	// that were read are still there under their own names, unless a
+	// column has taken the name.
+	Columns []Column
+	Where   Filter
+	OrderBy []Order
+	// Limit is the most shapes to return, or 0 for no limit.
+	Limit int
+}
+
+// Has reports whether a field is selected.
+func (s *Select) Has(field string) bool {
+	if s.All {
+		return true
+	}
+	for _, f := range s.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Renames reports whether the columns are anything but attributes of
+// the source under their own names.
+func (s *Select) Renames() bool {
+	for _, c := range s.Columns {
+		if f, ok := c.Expr.(*Field); !ok || f.Name != c.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSelect parses a statement, in a small subset of SQL:
+//
+//	[SELECT] * | expr [AS name], ... [FROM table]
+//	[WHERE filter] [ORDER BY expr [ASC | DESC], ...] [LIMIT n]
+//
+// The columns and keys are written as in filters, and the WHERE is a
+// filter; see Parse.  The keys may name columns.  The table is the
+// layer's source whatever it is called, so FROM is only there for
+// those used to writing it.  A list of fields on its own, like
+// "name,type", selects those fields.
+func ParseSelect(stmt string) (*Select, error) {
+	tokens, err := lex(stmt)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	sel := new(Select)
+	if p.peek().keyword("select") {
+		p.next()
+	}
+	if err := p.columns(sel); err != nil {
+		return nil, err
+	}
+	if p.peek().keyword("from") {
+		p.next()
+		if t := p.next(); t.kind != tokWord && t.kind != tokString && t.kind != tokField {
+			return nil, p.unexpected(t)
+		}
+	}
+	if p.peek().keyword("where") {
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		sel.Where = Filter{e}
+	}
+	if p.peek().keyword("order") {
+		p.next()
+		if err := p.orderBy(sel); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().keyword("limit") {
+		p.next()
+		t := p.next()
+		if sel.Limit, err = strconv.Atoi(t.text); t.kind != tokNumber || err != nil || sel.Limit < 0 {
+			return nil, &SyntaxError{t.col, fmt.Sprintf("expected a count, found %v", t)}
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	sel.Fields = sel.fields()
+	return sel, nil
+}
+
+var clauses = map[string]bool{"from": true, "where": true, "order": true, "limit": true}
+
+func (p *parser) columns(sel *Select) error {
+	if t := p.peek(); t.kind == tokOp && t.text == "*" {
+		p.next()
+		sel.All = true
+		return nil
+	}
+	for {
+		if t := p.peek(); t.kind == tokWord && clauses[strings.ToLower(t.text)] {
+			return p.unexpected(t)
+		}
+		e, err := p.operand(false)
+		if err != nil {
+			return err
+		}
+		c := Column{e.String(), e}
+		if f, ok := e.(*Field); ok {
+			c.Name = f.Name
+		}
+		if p.peek().keyword("as") {
+			p.next()
+			t := p.next()
+			if t.kind != tokWord && t.kind != tokString && t.kind != tokField {
+				return &SyntaxError{t.col, fmt.Sprintf("expected a name, found %v", t)}
+			}
+			c.Name = t.text
+		}
+		sel.Columns = append(sel.Columns, c)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) orderBy(sel *Select) error {
+	if t := p.next(); !t.keyword("by") {
+		return &SyntaxError{t.col, fmt.Sprintf("expected BY, found %v", t)}
+	}
+	for {
+		e, err := p.operand(false)
+		if err != nil {
+			return err
+		}
+		o := Order{Expr: e}
+		if t := p.peek(); t.keyword("asc") || t.keyword("desc") {
+			p.next()
+			o.Desc = t.keyword("desc")
+		}
+		sel.OrderBy = append(sel.OrderBy, o)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// fields lists the attributes of the source that the statement uses.
+func (s *Select) fields() []string {
+	var fields []string
+	seen := make(map[string]bool)
+	add := func(e Expr) {
+		for _, name := range Fields(e) {
+			if !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	for _, c := range s.Columns {
+		add(c.Expr)
+	}
+	add(s.Where.Expr)
+	for _, o := range s.OrderBy {
+		add(o.Expr)
+	}
+	return fields
+}
+
+// Row evaluates the columns for a shape.
+func (s *Select) Row(shape geom.Shape) map[string]string {
+	row := make(map[string]string, len(s.Columns))
+	for _, c := range s.Columns {
+		row[c.Name] = asString(c.Expr.Eval(shape))
+	}
+	return row
+}
+
+// Sort puts shapes in the order of the ORDER BY, keeping the order they
+// came in where their keys are the same.  Numbers come before text.
+func (s *Select) Sort(shapes []geom.Shape) {
+	if len(s.OrderBy) == 0 {
+		return
+	}
+	type keyed struct {
+		shape geom.Shape
+		keys  []Value
+	}
+	items := make([]keyed, len(shapes))
+	for i, shape := range shapes {
+		items[i].shape = shape
+		for _, o := range s.OrderBy {
+			items[i].keys = append(items[i].keys, o.Expr.Eval(shape))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		for k, o := range s.OrderBy {
+			if c := order(items[i].keys[k], items[j].keys[k]); c != 0 {
+				return c < 0 != o.Desc
+			}
+		}
+		return false
+	})
+	for i, item := range items {
+		shapes[i] = item.shape
+	}
+}
+
+func order(a, b Value) int {
+	an, aok := asNumber(a)
+	bn, bok := asNumber(b)
+	switch {
+	case aok && bok:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aok:
+		return -1
+	case bok:
+		return 1
+	}
+	return strings.Compare(asString(a), asString(b))
+}
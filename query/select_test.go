@@ -0,0 +1,86 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package query
+
+import (
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"testing"
+)
+
+func TestParseSelect(t *testing.T) {
+	sel, err := ParseSelect("SELECT name, [ref] AS label, kind.replace('_', ' ') as kind FROM roads " +
+		"WHERE lanes >= 2 AND kind != 'track' ORDER BY rank DESC, label LIMIT 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns []string
+	for _, c := range sel.Columns {
+		columns = append(columns, c.Name+"="+c.Expr.String())
+	}
+	if got := fmt.Sprint(columns); got != "[name=name label=ref kind=kind.replace('_', ' ')]" {
+		t.Errorf("unexpected columns %s", got)
+	}
+	if got := sel.Where.String(); got != "((lanes >= 2) and (kind != 'track'))" {
+		t.Errorf("unexpected where %s", got)
+	}
+	if len(sel.OrderBy) != 2 || !sel.OrderBy[0].Desc || sel.OrderBy[1].Desc || sel.Limit != 10 {
+		t.Errorf("unexpected order and limit %v %d", sel.OrderBy, sel.Limit)
+	}
+	if got := fmt.Sprint(sel.Fields); got != "[name ref kind lanes rank label]" {
+		t.Errorf("unexpected fields %s", got)
+	}
+	if !sel.Renames() {
+		t.Error("expected the statement to rename its columns")
+	}
+
+	if sel, err = ParseSelect("name,type"); err != nil || fmt.Sprint(sel.Fields) != "[name type]" || sel.Renames() {
+		t.Errorf("expected a plain field list, got %v, %v", sel, err)
+	}
+	if sel, err = ParseSelect("select * where pop > 10"); err != nil || !sel.All || !sel.Has("anything") {
+		t.Errorf("expected every field, got %v, %v", sel, err)
+	}
+
+	errors := []struct {
+		stmt string
+		col  int
+	}{
+		{"select from roads", 8},
+		{"select name order name", 19},
+		{"select name limit -1", 19},
+		{"select name limit 2.5", 19},
+		{"select name as", 15},
+		{"select name where", 18},
+		{"select name limit 1 where a", 21},
+	}
+	for _, test := range errors {
+		_, err := ParseSelect(test.stmt)
+		if serr, ok := err.(*SyntaxError); !ok || serr.Col != test.col {
+			t.Errorf("%q: expected a syntax error at column %d, got %v", test.stmt, test.col, err)
+		}
+	}
+}
+
+func TestSelectSort(t *testing.T) {
+	sel, err := ParseSelect("select * order by rank desc, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes := []geom.Shape{
+		attrShape{"name": "b", "rank": "2"},
+		attrShape{"name": "x", "rank": ""},
+		attrShape{"name": "a", "rank": "10"},
+		attrShape{"name": "a", "rank": "2"},
+	}
+	sel.Sort(shapes)
+	var got []string
+	for _, shape := range shapes {
+		got = append(got, shape.Attribute("name")+shape.Attribute("rank"))
+	}
+	// text sorts after numbers, so it comes first going down
+	if fmt.Sprint(got) != "[x a10 a2 b2]" {
+		t.Errorf("unexpected order %v", got)
+	}
+}
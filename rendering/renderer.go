@@ -8,6 +8,7 @@ import (
 	"github.com/llgcode/draw2d"
 	"github.com/llgcode/draw2d/draw2dimg"
 	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/geom/index"
 	"github.com/samlecuyer/ecumene/mapping"
 	"github.com/samlecuyer/ecumene/query"
 	"github.com/samlecuyer/ecumene/util"
@@ -26,6 +27,20 @@ type Renderer struct {
 	bbox          geom.Bbox
 	layers        [][]geom.Shape
 	matrix        draw2d.Matrix
+	// scale is the number of pixels per map unit
+	scale float64
+	// densify is the longest a segment may be, in radians, before it
+	// is split up to follow the curves of the projection
+	densify float64
+	// scaleDenominator is the scale being drawn, and vars holds the
+	// values that it gives the variables of filters
+	scaleDenominator float64
+	vars             map[string]query.Value
+	// area is what the window covers in longitude and latitude, which
+	// is all that layers are asked for
+	area geom.Bbox
+	// labels holds the space taken by the labels drawn so far
+	labels *index.RTree
 	sync.Mutex
 }
 
@@ -41,26 +56,20 @@ func NewRenderer(m *mapping.Map, width, height int) *Renderer {
 }
 
 func (r *Renderer) ClipTo(lng0, lat0, lng1, lat1 float64) {
-	r.bbox[0] = lng0
-	r.bbox[1] = lat0
-	r.bbox[2] = lng1
-	r.bbox[3] = lat1
+	r.bbox = geom.NewBbox(lng0, lat0, lng1, lat1)
 	log.Println("clipped to: ", r.bbox)
 }
 
 func (r *Renderer) ClipToMap() error {
 	b := r.m.Bounds()
-	x0, y0, _ := r.m.Srs.Forward(b[0], b[1])
-	x1, y1, _ := r.m.Srs.Forward(b[2], b[3])
-	r.bbox = geom.Bbox{x0, y0, x1, y1}
-
-	x0, y0, _ = r.m.Srs.Forward(b[0], b[3])
-	x1, y1, _ = r.m.Srs.Forward(b[2], b[1])
-	r.bbox = r.bbox.ExpandToFit(geom.Bbox{x0, y0, x1, y1})
-
-	x0, y0, _ = r.m.Srs.Forward(0, b[3])
-	x1, y1, _ = r.m.Srs.Forward(0, b[1])
-	r.bbox = r.bbox.ExpandToFit(geom.Bbox{x0, y0, x1, y1})
+	r.bbox = geom.EmptyBbox()
+	for _, corner := range [6][2]float64{
+		{b.MinX, b.MinY}, {b.MaxX, b.MinY}, {b.MaxX, b.MaxY}, {b.MinX, b.MaxY},
+		{0, b.MinY}, {0, b.MaxY},
+	} {
+		x, y, _ := r.m.Srs.Forward(corner[0], corner[1])
+		r.bbox = r.bbox.Union(geom.Point{x, y}.Bbox())
+	}
 
 	log.Println("clipped to: ", r.bbox)
 	return nil
@@ -75,7 +84,7 @@ func (r *Renderer) DrawAdjustedToFile(filename string) error {
 	dest := r.Draw()
 	if subimage, ok := dest.(SubImage); ok {
 		bb := r.bbox
-		x0, y0, x1, y1 := int(bb[0]), int(bb[1]), int(bb[2]), int(bb[3])
+		x0, y0, x1, y1 := int(bb.MinX), int(bb.MinY), int(bb.MaxX), int(bb.MaxY)
 		dest = subimage.SubImage(image.Rect(x0, y0, x1, y1))
 	}
 	return draw2dimg.SaveToPngFile(filename, dest)
@@ -99,34 +108,57 @@ func (r *Renderer) Draw() image.Image {
 	gc.SetStrokeColor(r.m.Stroke)
 	gc.SetFontData(draw2d.FontData{Name: "Georgia", Family: draw2d.FontFamilySerif, Style: draw2d.FontStyleNormal})
 
-	dx := math.Abs(r.bbox[2] - r.bbox[0])
-	dy := math.Abs(r.bbox[3] - r.bbox[1])
+	dx, dy := r.bbox.Width(), r.bbox.Height()
 
 	pxf, pyf := float64(pixelsX), float64(pixelsY)
 	r1, r2 := (pxf / dx), (pyf / dy)
 	r0 := math.Min(r1, r2)
+	r.scale = r0
 	w, h := dx*r0, dy*r0
 	ox, oy := (pxf-w)/2, (pyf-h)/2
 	img_box := [4]float64{ox, oy, ox + w, oy + h}
 
-	r.matrix = draw2d.NewMatrixFromRects(r.bbox, img_box)
+	// the top of the map is the top of the image, so the y axis flips
+	map_box := [4]float64{r.bbox.MinX, r.bbox.MaxY, r.bbox.MaxX, r.bbox.MinY}
+	r.matrix = draw2d.NewMatrixFromRects(map_box, img_box)
+	r.area = r.lngLatWindow()
+	r.densify = r.densifyLength()
+	r.scaleDenominator = r.findScaleDenominator()
+	r.vars = map[string]query.Value{
+		"zoom":              math.Round(mapping.Zoom(r.scaleDenominator)),
+		"scale_denominator": r.scaleDenominator,
+	}
+	r.labels = index.New(0)
 
 	for _, layer := range r.m.Layers {
-		q := query.NewQuery(r.m.Bounds()).Select(layer.SourceQuery())
+		if !layer.Contains(r.scaleDenominator) {
+			continue
+		}
+		q := r.layerQuery(layer)
 		if ds := layer.LoadSource(); ds != nil {
 			defer ds.Close()
+			symbolizers := make(map[util.SymbolizerType][]Symbolizer)
+			for _, t := range []util.SymbolizerType{util.PolygonType, util.PathType, util.PointType, util.TextType} {
+				symbolizers[t] = r.findSymbolizers(layer, t)
+			}
 			for shp := range ds.Query(q) {
-				var symbolizerType util.SymbolizerType
+				var symbolizerTypes []util.SymbolizerType
 				switch shp.(type) {
+				case geom.PointShape, geom.MultiPointShape:
+					symbolizerTypes = []util.SymbolizerType{util.PointType}
 				case geom.LineShape, geom.MultiLineShape:
-					symbolizerType = util.PathType
+					symbolizerTypes = []util.SymbolizerType{util.PathType}
 				case geom.PolygonShape:
-					symbolizerType = util.PolygonType
+					symbolizerTypes = []util.SymbolizerType{util.PolygonType}
+				case geom.CollectionShape:
+					symbolizerTypes = []util.SymbolizerType{util.PolygonType, util.PathType}
 				}
-				for _, symbolizer := range r.findSymbolizers(layer, symbolizerType) {
-					symbolizer.Draw(gc, shp)
+				for _, symbolizerType := range symbolizerTypes {
+					for _, symbolizer := range symbolizers[symbolizerType] {
+						symbolizer.Draw(gc, shp)
+					}
 				}
-				for _, symbolizer := range r.findSymbolizers(layer, util.TextType) {
+				for _, symbolizer := range symbolizers[util.TextType] {
 					symbolizer.Draw(gc, shp)
 				}
 			}
@@ -143,22 +175,22 @@ func (r *Renderer) graticule(gc draw2d.GraphicContext) {
 	// iterate over all the latitudes
 	padding := 20 * d2r
 	dxy := 0.001
-	for phi := b[1]; phi > b[3]; phi -= padding {
-		x, y, _ := r.m.Srs.Forward(b[0], phi)
+	for phi := b.MaxY; phi > b.MinY; phi -= padding {
+		x, y, _ := r.m.Srs.Forward(b.MinX, phi)
 		x, y = r.matrix.TransformPoint(x, y)
-		gc.MoveTo(phi, b[0])
-		for lam := b[0] + dxy; lam < b[2]; lam += dxy {
+		gc.MoveTo(phi, b.MinX)
+		for lam := b.MinX + dxy; lam < b.MaxX; lam += dxy {
 			x, y, _ = r.m.Srs.Forward(lam, phi)
 			x, y = r.matrix.TransformPoint(x, y)
 			gc.LineTo(x, y)
 		}
 		gc.Stroke()
 	}
-	for lam := b[0]; lam <= b[2]; lam += padding {
-		x, y, _ := r.m.Srs.Forward(lam, b[1])
+	for lam := b.MinX; lam <= b.MaxX; lam += padding {
+		x, y, _ := r.m.Srs.Forward(lam, b.MaxY)
 		x, y = r.matrix.TransformPoint(x, y)
-		gc.MoveTo(lam, b[1])
-		for phi := b[1] + dxy; phi >= b[3]; phi -= dxy {
+		gc.MoveTo(lam, b.MaxY)
+		for phi := b.MaxY + dxy; phi >= b.MinY; phi -= dxy {
 			x, y, _ = r.m.Srs.Forward(lam, phi)
 			x, y = r.matrix.TransformPoint(x, y)
 			gc.LineTo(x, y)
@@ -167,42 +199,264 @@ func (r *Renderer) graticule(gc draw2d.GraphicContext) {
 	}
 }
 
-func (r *Renderer) coordsAsPath(coords geom.Coordinates) *draw2d.Path {
-	path := new(draw2d.Path)
-	for i, point := range coords {
+// clipBuffer is how far past the edges of the image geometry is kept,
+// in pixels, so that wide strokes are not cut off at the border.
+const clipBuffer = 64
+
+// window is the area of the image that paths are clipped to.
+func (r *Renderer) window() geom.Bbox {
+	return geom.Bbox{MaxX: r.width, MaxY: r.height}.Buffer(clipBuffer)
+}
+
+// lngLatWindow works out the area the window covers, in longitude and
+// latitude: the box that its edges project back into, along with the
+// poles if it holds them.  Where the projection can't be undone, it is
+// the bounds of the map.
+func (r *Renderer) lngLatWindow() geom.Bbox {
+	bounds := r.m.Bounds()
+	c := r.bbox.Center()
+	dx, dy := (r.width/2+clipBuffer)/r.scale, (r.height/2+clipBuffer)/r.scale
+	window := geom.NewBbox(c[0]-dx, c[1]-dy, c[0]+dx, c[1]+dy)
+	if window.IsEmpty() {
+		return bounds
+	}
+	const steps = 16
+	area := geom.EmptyBbox()
+	for i := 0; i <= steps; i++ {
+		x := window.MinX + window.Width()*float64(i)/steps
+		y := window.MinY + window.Height()*float64(i)/steps
+		for _, p := range [4][2]float64{
+			{x, window.MinY}, {x, window.MaxY}, {window.MinX, y}, {window.MaxX, y},
+		} {
+			lng, lat, err := r.m.Srs.Inverse(p[0], p[1])
+			if err != nil || math.IsNaN(lng) || math.IsInf(lng, 0) || math.IsNaN(lat) || math.IsInf(lat, 0) {
+				return bounds
+			}
+			area = area.Union(geom.Point{lng, lat}.Bbox())
+		}
+	}
+	for _, lat := range [2]float64{-math.Pi / 2, math.Pi / 2} {
+		if x, y, err := r.m.Srs.Forward(0, lat); err == nil && window.ContainsPoint(geom.Point{x, y}) {
+			area = area.Union(geom.NewBbox(-math.Pi, lat, math.Pi, lat))
+		}
+	}
+	return area.Intersection(bounds)
+}
+
+// densifyPixels is about how long a segment may be on the image before
+// it is split up, so that straight lines in longitude and latitude
+// curve as they should once projected.
+const densifyPixels = 8
+
+// densifyLength converts densifyPixels to radians, at the scale of the
+// middle of the area being drawn.
+func (r *Renderer) densifyLength() float64 {
+	const step = 1e-6
+	c := r.area.Center()
+	x0, y0, _ := r.m.Srs.Forward(c[0], c[1])
+	x1, y1, _ := r.m.Srs.Forward(c[0]+step, c[1])
+	perRadian := math.Hypot(x1-x0, y1-y0) * r.scale / step
+	if !(perRadian > 0) || math.IsInf(perRadian, 0) {
+		return 0
+	}
+	return densifyPixels / perRadian
+}
+
+// pixelSize is the size of a pixel that scale denominators assume, in
+// metres.
+const pixelSize = 0.00028
+
+// findScaleDenominator works out the scale being drawn, from the length
+// of a map unit on the equator.
+func (r *Renderer) findScaleDenominator() float64 {
+	const step = 1e-6
+	x0, y0, _ := r.m.Srs.Forward(0, 0)
+	x1, y1, _ := r.m.Srs.Forward(step, 0)
+	metresPerUnit := geom.EarthRadius * step / math.Hypot(x1-x0, y1-y0)
+	return metresPerUnit / r.scale / pixelSize
+}
+
+// project moves coordinates into image space, dropping any that the map
+// projection can't handle.
+func (r *Renderer) project(coords geom.Coordinates) geom.Coordinates {
+	projected := make(geom.Coordinates, 0, len(coords))
+	for _, point := range coords {
 		x, y, _ := r.m.Srs.Forward(point[0], point[1])
 		x, y = r.matrix.TransformPoint(x, y)
-		if math.IsNaN(x) || math.IsInf(x, 1) {
+		if math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0) {
 			continue
 		}
+		projected = append(projected, geom.Point{x, y})
+	}
+	return projected
+}
+
+// projectDense projects a line or ring that has been cut down to the
+// area being drawn.  Unless the map is in longitude and latitude too,
+// long segments are densified first, so that they curve as they should;
+// cutting it first keeps that to what the window shows, however long
+// the segments are.
+func (r *Renderer) projectDense(coords geom.Coordinates) geom.Coordinates {
+	if !r.m.Srs.IsLngLat() {
+		coords = geom.Densify(coords, r.densify)
+	}
+	return r.project(coords)
+}
+
+// labelPoint is where a label for the shape goes, in image space.
+// Polygons are labelled at their pole of inaccessibility, found to the
+// nearest pixel, so that the label lands inside them even when they are
+// concave; everything else is labelled at the middle of its bounds.
+func (r *Renderer) labelPoint(shape geom.Shape) (float64, float64, bool) {
+	var polygons geom.MultiPolygon
+	if ps, ok := shape.(geom.PolygonShape); ok {
+		for _, polygon := range ps.Polygons() {
+			projected := make(geom.Polygon, 0, len(polygon))
+			for _, ring := range polygon {
+				if ring = r.project(ring); len(ring) > 0 {
+					projected = append(projected, ring)
+				}
+			}
+			if len(projected) > 0 {
+				polygons = append(polygons, projected)
+			}
+		}
+	}
+	if len(polygons) > 0 {
+		p := geom.LabelPoint(polygons, 1)
+		return p[0], p[1], !math.IsNaN(p[0])
+	}
+	center := r.project(geom.Coordinates{shape.Bbox().Center()})
+	if len(center) == 0 {
+		return 0, 0, false
+	}
+	return center[0][0], center[0][1], true
+}
+
+// simplifier picks the algorithm a symbolizer asked for, and converts
+// its tolerance to pixels.
+func (r *Renderer) simplifier(s mapping.Simplification) (geom.Simplifier, float64) {
+	tolerance := s.Simplify
+	if s.SimplifyUnits == "map" {
+		tolerance *= r.scale
+	}
+	if s.SimplifyAlgorithm == "visvalingam-whyatt" {
+		return geom.Visvalingam, tolerance
+	}
+	return geom.DouglasPeucker, tolerance
+}
+
+// coordsAsPath cuts a line at the antimeridian and to the area being
+// drawn, then projects, clips and simplifies it, and moves it to the
+// offset the symbolizer asks for.  Geodesic lines follow great circles
+// between their points: roughly, at a sixteenth of the area, before
+// the line is cut, and closely after.
+func (r *Renderer) coordsAsPath(coords geom.Coordinates, s *mapping.PathSymbolizer) *draw2d.Path {
+	if s.Geodesic {
+		rough := math.Hypot(r.area.Width(), r.area.Height()) / 16
+		coords = geom.DensifyGreatCircle(coords, math.Max(rough, r.densify)*geom.EarthRadius)
+	}
+	parts := geom.Multiline{coords}
+	if cut, ok := geom.CutAntimeridian(coords).(geom.Multiline); ok {
+		parts = cut
+	}
+	simplify, tolerance := r.simplifier(s.Simplification)
+	path := new(draw2d.Path)
+	for _, part := range parts {
+		for _, piece := range geom.ClipLine(part, r.area) {
+			if s.Geodesic {
+				piece = geom.DensifyGreatCircle(piece, r.densify*geom.EarthRadius)
+			}
+			for _, line := range geom.ClipLine(r.projectDense(piece), r.window()) {
+				line = simplify(line, tolerance)
+				if s.Offset != 0 {
+					// y points down in pixels, which swaps left and right
+					line = geom.Offset(line, -s.Offset, geom.JoinRound)
+				}
+				appendCoords(path, line)
+			}
+		}
+	}
+	return path
+}
+
+// polygonAsPath builds one path out of every ring of the polygon, so
+// that filling it with the even-odd rule leaves the holes empty.  The
+// polygon is cut to the area being drawn before it is projected.
+func (r *Renderer) polygonAsPath(polygon geom.Polygon, s mapping.Simplification) *draw2d.Path {
+	polygon = geom.ClipPolygon(polygon, r.area)
+	projected := make(geom.Polygon, len(polygon))
+	for i, ring := range polygon {
+		projected[i] = r.projectDense(ring)
+	}
+	simplify, tolerance := r.simplifier(s)
+	clipped := geom.ClipPolygon(projected, r.window())
+	path := new(draw2d.Path)
+	for _, ring := range geom.SimplifyPolygon(clipped, tolerance, simplify) {
+		appendCoords(path, ring)
+		path.Close()
+	}
+	return path
+}
+
+func appendCoords(path *draw2d.Path, coords geom.Coordinates) {
+	for i, point := range coords {
 		if i == 0 {
-			path.MoveTo(x, y)
+			path.MoveTo(point[0], point[1])
 		} else {
-			path.LineTo(x, y)
+			path.LineTo(point[0], point[1])
 		}
 	}
-	return path
 }
 
-func (r *Renderer) findSymbolizers(layer *mapping.Layer, filter util.SymbolizerType) []Symbolizer {
-	var symbolizers []Symbolizer
+// layerQuery asks for the shapes of a layer that one of its rules would
+// draw, with the attributes that its rules use.
+func (r *Renderer) layerQuery(layer *mapping.Layer) *query.Query {
+	q := query.NewQuery(r.area).With(layer.Statement())
+	var conditions []query.Filter
+	for _, rule := range r.rules(layer) {
+		conditions = append(conditions, rule.Condition)
+		q.Include(rule.Condition.Fields()...)
+		if ts, ok := rule.Symbolizers[util.TextType].(*mapping.TextSymbolizer); ok {
+			q.Include(query.Fields(ts.Label)...)
+		}
+	}
+	return q.Where(query.Any(conditions...))
+}
+
+// rules lists the rules of a layer's styles that show at the scale
+// being drawn, with the variables of their filters bound.
+func (r *Renderer) rules(layer *mapping.Layer) []*mapping.Rule {
+	var rules []*mapping.Rule
 	for _, styleName := range layer.Styles() {
 		if style := r.m.FindStyle(styleName); style != nil {
 			for _, rule := range style.Rules {
-				if ps, ok := rule.Symbolizers[filter]; ok {
-					switch specific := ps.(type) {
-					case *mapping.PolygonSymbolizer:
-						symbolizers = append(symbolizers, &PolygonSymbolizer{query.Filter(rule.Filter), r, specific})
-					case *mapping.PathSymbolizer:
-						symbolizers = append(symbolizers, &PathSymbolizer{query.Filter(rule.Filter), r, specific})
-					case *mapping.TextSymbolizer:
-						symbolizers = append(symbolizers, &TextSymbolizer{query.Filter(rule.Filter), r, specific})
-					default:
-						log.Println(reflect.TypeOf(ps).Elem())
-					}
+				if rule.Contains(r.scaleDenominator) {
+					bound := *rule
+					bound.Condition = rule.Condition.Bind(r.vars)
+					rules = append(rules, &bound)
 				}
 			}
 		}
 	}
+	return rules
+}
+
+func (r *Renderer) findSymbolizers(layer *mapping.Layer, filter util.SymbolizerType) []Symbolizer {
+	var symbolizers []Symbolizer
+	for _, rule := range r.rules(layer) {
+		if ps, ok := rule.Symbolizers[filter]; ok {
+			switch specific := ps.(type) {
+			case *mapping.PolygonSymbolizer:
+				symbolizers = append(symbolizers, &PolygonSymbolizer{rule.Condition, r, specific})
+			case *mapping.PathSymbolizer:
+				symbolizers = append(symbolizers, &PathSymbolizer{rule.Condition, r, specific})
+			case *mapping.TextSymbolizer:
+				symbolizers = append(symbolizers, &TextSymbolizer{rule.Condition, r, specific})
+			default:
+				log.Println(reflect.TypeOf(ps).Elem())
+			}
+		}
+	}
 	return symbolizers
 }
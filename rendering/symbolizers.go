@@ -9,7 +9,6 @@ import (
 	"github.com/samlecuyer/ecumene/geom"
 	"github.com/samlecuyer/ecumene/mapping"
 	"github.com/samlecuyer/ecumene/query"
-	"math"
 )
 
 type Symbolizer interface {
@@ -27,15 +26,31 @@ func (ps *PolygonSymbolizer) Draw(gc draw2d.GraphicContext, shape geom.Shape) {
 	if !ps.Applies(shape) {
 		return
 	}
-	if polygon, ok := shape.(geom.PolygonShape); ok {
-		gc.SetFillColor(ps.s.Fill)
-		for _, path := range polygon.Polygon() {
-			l := ps.r.coordsAsPath(path)
-			gc.Fill(l)
+	gc.SetFillColor(ps.s.Fill)
+	gc.SetFillRule(draw2d.FillRuleEvenOdd)
+	switch specific := shape.(type) {
+	case geom.PolygonShape:
+		ps.fill(gc, specific.Polygons())
+	case geom.CollectionShape:
+		for _, g := range specific.Geometries() {
+			switch g := g.(type) {
+			case geom.Polygon:
+				ps.fill(gc, geom.MultiPolygon{g})
+			case geom.MultiPolygon:
+				ps.fill(gc, g)
+			}
 		}
 	}
 }
 
+// fill draws the polygons, cut at the antimeridian so that those that
+// cross it don't streak across the map.
+func (ps *PolygonSymbolizer) fill(gc draw2d.GraphicContext, polygons geom.MultiPolygon) {
+	for _, polygon := range geom.CutAntimeridian(polygons).(geom.MultiPolygon) {
+		gc.Fill(ps.r.polygonAsPath(polygon, ps.s.Simplification))
+	}
+}
+
 type PathSymbolizer struct {
 	query.Filter
 	r *Renderer
@@ -50,13 +65,24 @@ func (ps *PathSymbolizer) Draw(gc draw2d.GraphicContext, shape geom.Shape) {
 	gc.SetLineWidth(ps.s.Weight)
 	switch specific := shape.(type) {
 	case geom.LineShape:
-		l := ps.r.coordsAsPath(specific.Path())
+		l := ps.r.coordsAsPath(specific.Path(), ps.s)
 		gc.Stroke(l)
 	case geom.MultiLineShape:
 		for _, path := range specific.Paths() {
-			l := ps.r.coordsAsPath(path)
+			l := ps.r.coordsAsPath(path, ps.s)
 			gc.Stroke(l)
 		}
+	case geom.CollectionShape:
+		for _, g := range specific.Geometries() {
+			switch g := g.(type) {
+			case geom.Coordinates:
+				gc.Stroke(ps.r.coordsAsPath(g, ps.s))
+			case geom.Multiline:
+				for _, path := range g {
+					gc.Stroke(ps.r.coordsAsPath(path, ps.s))
+				}
+			}
+		}
 	}
 }
 
@@ -70,16 +96,21 @@ func (ts *TextSymbolizer) Draw(gc draw2d.GraphicContext, shape geom.Shape) {
 	if !ts.Applies(shape) {
 		return
 	}
-	if name := shape.Attribute(ts.s.Attr); name != "" {
+	if name := query.Text(ts.s.Label, shape); name != "" {
+		x, y, ok := ts.r.labelPoint(shape)
+		if !ok {
+			return
+		}
 		gc.SetFontSize(ts.s.Size)
 		l, t, r, b := gc.GetStringBounds(name)
-		bb := shape.Bbox()
-		dx := math.Abs(bb[2] - bb[0])
-		dy := math.Abs(bb[3] - bb[1])
-		ox, oy := dx/2, dy/2
-
-		x, y := ts.r.matrix.TransformPoint(bb[0]+ox, bb[1]-oy)
+		x, y = x-(r-l)/2, y-(t-b)/2
+		// labels that would run into one already drawn are skipped
+		space := geom.NewBbox(x+l, y+t, x+r, y+b)
+		if ts.r.labels.Collides(space) {
+			return
+		}
+		ts.r.labels.Insert(space.Polygon())
 		gc.SetFillColor(ts.s.Fill)
-		gc.FillStringAt(name, x-(r-l)/2, y-(t-b)/2)
+		gc.FillStringAt(name, x, y)
 	}
 }
@@ -0,0 +1,148 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"errors"
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+)
+
+var ErrUnknownDerivation = errors.New("Unknown Derivation")
+
+// Derivation says which shapes a derived source computes out of the
+// points of another.  Kind is one of "convex-hull", "concave-hull",
+// "delaunay" or "voronoi".  With a GroupBy attribute, the points are
+// split up by its value and each group is derived on its own, which is
+// how clusters get an outline each.  MaxEdge is passed on to
+// geom.ConcaveHull.
+type Derivation struct {
+	Kind    string
+	GroupBy string
+	MaxEdge float64
+}
+
+type derivedSource struct {
+	DataSource
+	d Derivation
+}
+
+// Derived wraps ds in a source that emits shapes computed out of the
+// points ds finds.  Hulls and triangles carry the GroupBy attribute of
+// their group, and Voronoi cells, which are cut to the bounds of the
+// query, carry every attribute of the point they belong to.  Only the
+// points ds finds within the bounds of a query are used, so shapes
+// near the edges of a query can differ from one query to the next.
+func Derived(ds DataSource, d Derivation) (DataSource, error) {
+	switch d.Kind {
+	case "convex-hull", "concave-hull", "delaunay", "voronoi":
+		return &derivedSource{ds, d}, nil
+	}
+	return nil, ErrUnknownDerivation
+}
+
+func (s *derivedSource) Query(q *query.Query) chan geom.Shape {
+	ch := make(chan geom.Shape, 1000)
+	go s.searchFor(q, ch)
+	return ch
+}
+
+type pointGroup struct {
+	points geom.MultiPoint
+	owners []geom.Shape
+}
+
+func (s *derivedSource) searchFor(q *query.Query, ch chan geom.Shape) {
+	defer close(ch)
+
+	// the filters are for the derived shapes, not the points
+	inner := *q
+	inner.Filters = nil
+	if s.d.GroupBy != "" && q.Sel != nil {
+		sel := *q.Sel
+		sel.Fields = append([]string{s.d.GroupBy}, q.Sel.Fields...)
+		inner.Sel = &sel
+	}
+	groups := make(map[string]*pointGroup)
+	var keys []string
+	for shape := range s.DataSource.Query(&inner) {
+		var key string
+		if s.d.GroupBy != "" {
+			key = shape.Attribute(s.d.GroupBy)
+		}
+		group := groups[key]
+		if group == nil {
+			group = new(pointGroup)
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		for _, p := range pointsOf(shape) {
+			group.points = append(group.points, p)
+			group.owners = append(group.owners, shape)
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		attrs := make(map[string]string)
+		if s.d.GroupBy != "" {
+			attrs[s.d.GroupBy] = key
+		}
+		emit := func(polygon geom.Polygon, attrs map[string]string) {
+			if len(polygon) == 0 {
+				return
+			}
+			if shape := (&derivedShape{geom.MultiPolygon{polygon}, attrs}); q.Matches(shape) {
+				ch <- shape
+			}
+		}
+		switch s.d.Kind {
+		case "convex-hull":
+			emit(geom.ConvexHull(group.points), attrs)
+		case "concave-hull":
+			emit(geom.ConcaveHull(group.points, s.d.MaxEdge), attrs)
+		case "delaunay":
+			for _, triangle := range geom.Delaunay(group.points).Polygons() {
+				emit(triangle, attrs)
+			}
+		case "voronoi":
+			seen := make(map[geom.Point]bool)
+			for i, cell := range geom.Voronoi(group.points, q.Bounds) {
+				if p := group.points[i]; !seen[p] {
+					seen[p] = true
+					emit(cell, attributesOf(group.owners[i]))
+				}
+			}
+		}
+	}
+}
+
+// pointsOf lists the points of point shapes.  Other shapes have none.
+func pointsOf(shape geom.Shape) geom.MultiPoint {
+	switch s := shape.(type) {
+	case geom.PointShape:
+		return geom.MultiPoint{s.Point()}
+	case geom.MultiPointShape:
+		return s.Points()
+	}
+	return nil
+}
+
+func attributesOf(shape geom.Shape) map[string]string {
+	if s, ok := shape.(geom.AttributedShape); ok {
+		return s.Attributes()
+	}
+	return nil
+}
+
+type derivedShape struct {
+	polygons geom.MultiPolygon
+	attrs    map[string]string
+}
+
+func (s *derivedShape) Bbox() geom.Bbox               { return s.polygons.Bbox() }
+func (s *derivedShape) Polygons() geom.MultiPolygon   { return s.polygons }
+func (s *derivedShape) Attribute(name string) string  { return s.attrs[name] }
+func (s *derivedShape) Attributes() map[string]string { return s.attrs }
@@ -0,0 +1,74 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"testing"
+)
+
+type pointShape struct {
+	p     geom.Point
+	attrs map[string]string
+}
+
+func (s *pointShape) Bbox() geom.Bbox               { return s.p.Bbox() }
+func (s *pointShape) Point() geom.Point             { return s.p }
+func (s *pointShape) Attribute(name string) string  { return s.attrs[name] }
+func (s *pointShape) Attributes() map[string]string { return s.attrs }
+
+func clusters() DataSource {
+	var shapes []geom.Shape
+	for _, c := range []struct {
+		name string
+		x, y float64
+	}{{"a", 0, 0}, {"b", 5, 5}} {
+		for _, d := range []geom.Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0.5, 0.5}} {
+			shapes = append(shapes, &pointShape{
+				geom.Point{c.x + d[0], c.y + d[1]},
+				map[string]string{"cluster": c.name},
+			})
+		}
+	}
+	return NewMemorySource(shapes)
+}
+
+func TestDerivedHulls(t *testing.T) {
+	ds, err := Derived(clusters(), Derivation{Kind: "convex-hull", GroupBy: "cluster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hulls := make(map[string]geom.MultiPolygon)
+	for shape := range ds.Query(query.NewQuery(geom.NewBbox(-1, -1, 10, 10))) {
+		hulls[shape.Attribute("cluster")] = shape.(geom.PolygonShape).Polygons()
+	}
+	if len(hulls) != 2 || geom.Area(hulls["a"]) != 1 || geom.Area(hulls["b"]) != 1 {
+		t.Errorf("expected a unit square around each cluster, got %v", hulls)
+	}
+}
+
+func TestDerivedVoronoi(t *testing.T) {
+	ds, err := Derived(clusters(), Derivation{Kind: "voronoi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := geom.NewBbox(-1, -1, 10, 10)
+	cells, area := 0, 0.0
+	for shape := range ds.Query(query.NewQuery(bounds)) {
+		cells++
+		area += geom.Area(geom.GeometryOf(shape))
+		if shape.Attribute("cluster") == "" {
+			t.Error("expected each cell to keep the attributes of its point")
+		}
+	}
+	if cells != 10 || area < bounds.Width()*bounds.Height()-1e-9 {
+		t.Errorf("expected 10 cells covering the bounds, got %d covering %v", cells, area)
+	}
+
+	if _, err := Derived(clusters(), Derivation{Kind: "blob"}); err != ErrUnknownDerivation {
+		t.Errorf("expected an unknown derivation to be refused, got %v", err)
+	}
+}
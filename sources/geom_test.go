@@ -6,6 +6,8 @@ package sources
 
 import (
 	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/go-shp"
+	"math"
 	"testing"
 )
 
@@ -20,3 +22,30 @@ func TestPolygonTyping(t *testing.T) {
 		t.Error("shpPolygonZ should be a PolygonShape")
 	}
 }
+
+func TestZMOf(t *testing.T) {
+	z := []float64{1, 2, 3, 4, 5}
+	m := []float64{0, 1, -1e39, 3, 4}
+	// the empty part is left out, just as partsOf leaves it out
+	zms := zmOf([]int32{0, 2, 2}, len(z), z, m)
+	if len(zms) != 2 || len(zms[0].Z) != 2 || len(zms[1].Z) != 3 {
+		t.Fatalf("expected parts of 2 and 3 values, got %v", zms)
+	}
+	if zms[1].Z[0] != 3 || zms[1].M[1] != 3 || !math.IsNaN(zms[1].M[0]) {
+		t.Errorf("unexpected values %v", zms[1])
+	}
+	if zms := zmOf([]int32{0}, 2, nil, []float64{1, 2}); zms[0].Z != nil || len(zms[0].M) != 2 {
+		t.Errorf("expected measures without elevations, got %v", zms)
+	}
+
+	line := &shpPolyLineZ{
+		PolyLineZ: &shp.PolyLineZ{Parts: []int32{0}, Points: make([]shp.Point, 5), ZArray: z, MArray: m},
+		attrs:     map[string]string{"z": "contour"},
+	}
+	if v := line.Attribute("z_max"); v != "5" {
+		t.Errorf("expected z_max to be 5, got %q", v)
+	}
+	if v := line.Attribute("z"); v != "contour" {
+		t.Errorf("expected a real attribute to come first, got %q", v)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/geom/index"
+	"github.com/samlecuyer/ecumene/query"
+)
+
+// memorySource keeps its shapes in an R-tree, so a query only looks at
+// the shapes near its bounds.
+type memorySource struct {
+	index *index.RTree
+}
+
+// NewMemorySource serves shapes that are already loaded.  Their
+// coordinates are longitude and latitude in radians, like the shapes
+// of every other source.
+func NewMemorySource(shapes []geom.Shape) DataSource {
+	items := make([]index.Item, len(shapes))
+	for i, shape := range shapes {
+		items[i] = shape
+	}
+	return &memorySource{index.Load(0, items)}
+}
+
+func (s *memorySource) Close() {}
+
+func (s *memorySource) Query(q *query.Query) chan geom.Shape {
+	ch := make(chan geom.Shape, 1000)
+	go s.searchFor(q, ch)
+	return ch
+}
+
+func (s *memorySource) searchFor(q *query.Query, ch chan geom.Shape) {
+	defer close(ch)
+	bounds := q.Bounds.Polygon()
+	sent := 0
+	s.index.SearchFunc(q.Bounds, func(item index.Item) bool {
+		shape := item.(geom.Shape)
+		if q.Matches(shape) && geom.Intersects(geom.GeometryOf(shape), bounds) {
+			ch <- shape
+			sent++
+		}
+		return q.Limit == 0 || sent < q.Limit
+	})
+}
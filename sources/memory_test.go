@@ -0,0 +1,62 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"sort"
+	"testing"
+)
+
+type memoryShape struct {
+	name string
+	path geom.Coordinates
+}
+
+func (s *memoryShape) Bbox() geom.Bbox              { return s.path.Bbox() }
+func (s *memoryShape) Path() geom.Coordinates       { return s.path }
+func (s *memoryShape) Attribute(name string) string { return s.name }
+
+func TestMemorySource(t *testing.T) {
+	ds := NewMemorySource([]geom.Shape{
+		&memoryShape{"inside", geom.Coordinates{{1, 1}, {2, 2}}},
+		&memoryShape{"crossing", geom.Coordinates{{-1, 5}, {11, 5}}},
+		&memoryShape{"outside", geom.Coordinates{{20, 20}, {30, 30}}},
+		// its bounds meet the query, but the line itself doesn't
+		&memoryShape{"corner", geom.Coordinates{{9, 12}, {12, 9}}},
+	})
+	defer ds.Close()
+
+	var names []string
+	for shape := range ds.Query(query.NewQuery(geom.NewBbox(0, 0, 10, 10))) {
+		names = append(names, shape.Attribute("name"))
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "crossing" || names[1] != "inside" {
+		t.Errorf("expected the crossing and inside shapes, got %v", names)
+	}
+}
+
+func TestMemorySourceFilters(t *testing.T) {
+	ds := NewMemorySource([]geom.Shape{
+		&memoryShape{"a", geom.Coordinates{{1, 1}, {2, 2}}},
+		&memoryShape{"b", geom.Coordinates{{3, 3}, {4, 4}}},
+		&memoryShape{"c", geom.Coordinates{{20, 20}, {30, 30}}},
+	})
+	defer ds.Close()
+
+	f, err := query.Compile("name != 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for shape := range ds.Query(query.NewQuery(geom.NewBbox(0, 0, 10, 10)).Where(f)) {
+		names = append(names, shape.Attribute("name"))
+	}
+	if len(names) != 1 || names[0] != "b" {
+		t.Errorf("expected only the b shape, got %v", names)
+	}
+}
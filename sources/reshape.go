@@ -0,0 +1,111 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"math"
+)
+
+// reshape gives a shape another geometry, but keeps its attributes.
+// It returns nil if the geometry is empty.
+func reshape(shape geom.Shape, g geom.Geometry) geom.Shape {
+	base := reshaped{shape}
+	switch g := g.(type) {
+	case geom.ZMGeometry:
+		return reshape(shape, g.Geometry)
+	case geom.Point:
+		if !math.IsNaN(g[0]) {
+			return &reshapedPoint{base, g}
+		}
+	case geom.MultiPoint:
+		if len(g) > 0 {
+			return &reshapedPoints{base, g}
+		}
+	case geom.Coordinates:
+		if len(g) > 0 {
+			return &reshapedPath{base, g}
+		}
+	case geom.Multiline:
+		if len(g) > 0 {
+			return &reshapedPaths{base, g}
+		}
+	case geom.Polygon:
+		if len(g) > 0 {
+			return &reshapedPolygons{base, geom.MultiPolygon{g}}
+		}
+	case geom.MultiPolygon:
+		if len(g) > 0 {
+			return &reshapedPolygons{base, g}
+		}
+	case geom.GeometryCollection:
+		return &reshapedCollection{base, g}
+	}
+	return nil
+}
+
+// reshaped keeps the attributes of the shape it stands in for.
+type reshaped struct {
+	geom.Shape
+}
+
+func (r reshaped) Attributes() map[string]string {
+	if shape, ok := r.Shape.(geom.AttributedShape); ok {
+		return shape.Attributes()
+	}
+	return nil
+}
+
+func (r reshaped) LookupAttribute(name string) (string, bool) {
+	return geom.LookupAttribute(r.Shape, name)
+}
+
+type reshapedPoint struct {
+	reshaped
+	p geom.Point
+}
+
+func (r *reshapedPoint) Bbox() geom.Bbox   { return r.p.Bbox() }
+func (r *reshapedPoint) Point() geom.Point { return r.p }
+
+type reshapedPoints struct {
+	reshaped
+	points geom.MultiPoint
+}
+
+func (r *reshapedPoints) Bbox() geom.Bbox         { return r.points.Bbox() }
+func (r *reshapedPoints) Points() geom.MultiPoint { return r.points }
+
+type reshapedPath struct {
+	reshaped
+	path geom.Coordinates
+}
+
+func (r *reshapedPath) Bbox() geom.Bbox        { return r.path.Bbox() }
+func (r *reshapedPath) Path() geom.Coordinates { return r.path }
+
+type reshapedPaths struct {
+	reshaped
+	paths geom.Multiline
+}
+
+func (r *reshapedPaths) Bbox() geom.Bbox       { return r.paths.Bbox() }
+func (r *reshapedPaths) Paths() geom.Multiline { return r.paths }
+
+type reshapedPolygons struct {
+	reshaped
+	polygons geom.MultiPolygon
+}
+
+func (r *reshapedPolygons) Bbox() geom.Bbox             { return r.polygons.Bbox() }
+func (r *reshapedPolygons) Polygons() geom.MultiPolygon { return r.polygons }
+
+type reshapedCollection struct {
+	reshaped
+	geometries geom.GeometryCollection
+}
+
+func (r *reshapedCollection) Bbox() geom.Bbox                     { return r.geometries.Bbox() }
+func (r *reshapedCollection) Geometries() geom.GeometryCollection { return r.geometries }
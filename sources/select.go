@@ -0,0 +1,116 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+)
+
+type selectingSource struct {
+	DataSource
+}
+
+// Selecting runs the parts of a query's statement that sources leave
+// alone: it names the columns, puts the shapes in order and stops at
+// the limit, the same way whatever the source is.  Sources only read
+// the fields selected, and apply the WHERE and the filters.
+func Selecting(ds DataSource) DataSource {
+	return &selectingSource{ds}
+}
+
+func (s *selectingSource) Query(q *query.Query) chan geom.Shape {
+	sel := q.Sel
+	if sel == nil || !sel.Renames() && len(sel.OrderBy) == 0 && sel.Limit == 0 {
+		return s.DataSource.Query(q)
+	}
+	inner := *q
+	switch {
+	case sel.Renames():
+		// the filters may use the names of the columns, which only
+		// exist once the source is done
+		inner.Filters = nil
+	case len(sel.OrderBy) == 0:
+		// the source applies every filter, so the first shapes it
+		// sends are the ones kept
+		inner.Limit = sel.Limit
+	}
+	in := s.DataSource.Query(&inner)
+	ch := make(chan geom.Shape, 1000)
+	go func() {
+		defer close(ch)
+		var shapes []geom.Shape
+		sent := 0
+		for shape := range in {
+			if len(sel.OrderBy) == 0 && sel.Limit > 0 && sent == sel.Limit {
+				// a source that doesn't stop at the limit is drained
+				// without doing anything more with its shapes
+				continue
+			}
+			if sel.Renames() {
+				shape = reshape(&columnShape{shape, sel.Row(shape)}, geom.GeometryOf(shape))
+				if shape == nil || !applies(q.Filters, shape) {
+					continue
+				}
+			}
+			switch {
+			case len(sel.OrderBy) > 0:
+				shapes = append(shapes, shape)
+			default:
+				ch <- shape
+				sent++
+			}
+		}
+		sel.Sort(shapes)
+		if sel.Limit > 0 && len(shapes) > sel.Limit {
+			shapes = shapes[:sel.Limit]
+		}
+		for _, shape := range shapes {
+			ch <- shape
+		}
+	}()
+	return ch
+}
+
+func applies(filters []query.Filter, shape geom.Shape) bool {
+	for _, f := range filters {
+		if !f.Applies(shape) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnShape has the columns of a statement as its attributes, and
+// those of the shape it came from that aren't hidden by one.
+type columnShape struct {
+	geom.Shape
+	row map[string]string
+}
+
+func (s *columnShape) Attribute(name string) string {
+	if v, ok := s.row[name]; ok {
+		return v
+	}
+	return s.Shape.Attribute(name)
+}
+
+func (s *columnShape) LookupAttribute(name string) (string, bool) {
+	if v, ok := s.row[name]; ok {
+		return v, true
+	}
+	return geom.LookupAttribute(s.Shape, name)
+}
+
+func (s *columnShape) Attributes() map[string]string {
+	attrs := make(map[string]string)
+	for k, v := range attributesOf(s.Shape) {
+		attrs[k] = v
+	}
+	for k, v := range s.row {
+		attrs[k] = v
+	}
+	return attrs
+}
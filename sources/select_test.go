@@ -0,0 +1,70 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"testing"
+)
+
+// limitSource records the limit it was last asked for.
+type limitSource struct {
+	DataSource
+	limit int
+}
+
+func (s *limitSource) Query(q *query.Query) chan geom.Shape {
+	s.limit = q.Limit
+	return s.DataSource.Query(q)
+}
+
+func TestSelecting(t *testing.T) {
+	var shapes []geom.Shape
+	for i, name := range []string{"d", "a", "c", "b", "e"} {
+		shapes = append(shapes, &pointShape{
+			geom.Point{float64(i), float64(i)},
+			map[string]string{"name": name, "rank": fmt.Sprint(i % 3)},
+		})
+	}
+	source := &limitSource{DataSource: NewMemorySource(shapes)}
+	ds := Selecting(source)
+	defer ds.Close()
+
+	sel, err := query.ParseSelect("select name.replace('[a-c]', 'x') as label, rank where rank != 1 order by rank desc, label limit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := query.Compile("label != 'd'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for shape := range ds.Query(query.NewQuery(geom.NewBbox(-1, -1, 10, 10)).With(sel).Where(f)) {
+		if _, ok := shape.(geom.PointShape); !ok {
+			t.Fatalf("expected the shapes to stay points, got %T", shape)
+		}
+		got = append(got, shape.Attribute("label")+shape.Attribute("rank")+shape.Attribute("name"))
+	}
+	// the where drops a and e, and the filter d by its label, which
+	// leaves c, of the highest rank, then b
+	if fmt.Sprint(got) != "[x2c x0b]" {
+		t.Errorf("unexpected shapes %v", got)
+	}
+
+	// without an order, the limit takes the first that come
+	sel, _ = query.ParseSelect("select * limit 3")
+	n := 0
+	for _ = range ds.Query(query.NewQuery(geom.NewBbox(-1, -1, 10, 10)).With(sel)) {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("expected 3 shapes, got %d", n)
+	}
+	if source.limit != 3 {
+		t.Errorf("expected the limit to be passed to the source, got %d", source.limit)
+	}
+}
@@ -5,13 +5,10 @@
 package sources
 
 import (
-	"fmt"
 	"github.com/samlecuyer/ecumene/geom"
 	"github.com/samlecuyer/ecumene/query"
-	"github.com/samlecuyer/ecumene/util"
 	"github.com/samlecuyer/go-shp"
 	"github.com/samlecuyer/projectron"
-	"reflect"
 	"strings"
 	"math"
 )
@@ -47,39 +44,16 @@ func (p *shpPolygon) Attribute(s string) string {
 	return p.attrs[s]
 }
 
-func (s *shpPolygon) Bbox() geom.Bbox {
-	b := s.p.BBox()
-	x0, y0 := util.Gps2webmerc(b.MinX, b.MaxY)
-	x1, y1 := util.Gps2webmerc(b.MaxX, b.MinY)
-	return geom.Bbox{x0, y0, x1, y1}
+func (p *shpPolygon) Attributes() map[string]string {
+	return p.attrs
 }
 
-func (p *shpPolygon) Polygon() geom.Multiline {
-	pgz := p.p
-	lines := make(geom.Multiline, len(pgz.Parts))
-	var length int32
-	factor := 1.0
-	if p.srs.IsLngLat() {
-		factor = d2r
-	}
-	for i, idx := range pgz.Parts {
-		ln := len(pgz.Parts)
-		if i+1 >= ln {
-			length = int32(len(pgz.Points)) - idx
-		} else {
-			length = pgz.Parts[i+1] - idx
-		}
-		if length == 0 {
-			continue
-		}
+func (s *shpPolygon) Bbox() geom.Bbox {
+	return lngLatBbox(s.srs, s.p.BBox())
+}
 
-		lines[i] = make(geom.Coordinates, length)
-		for j, point := range pgz.Points[idx : idx+length] {
-			lng, lat, _ := p.srs.Inverse(point.X * factor, point.Y * factor)
-			lines[i][j] = geom.Point{lng, lat}
-		}
-	}
-	return lines
+func (p *shpPolygon) Polygons() geom.MultiPolygon {
+	return geom.AssemblePolygons(partsOf(p.p.Parts, p.p.Points, p.srs))
 }
 
 type shpPolygonZ struct {
@@ -89,38 +63,23 @@ type shpPolygonZ struct {
 }
 
 func (p *shpPolygonZ) Attribute(s string) string {
-	return p.attrs[s]
+	return zmAttribute(p, p.attrs, s)
+}
+
+func (p *shpPolygonZ) Attributes() map[string]string {
+	return p.attrs
 }
 
 func (p *shpPolygonZ) Bbox() geom.Bbox {
-	b := p.BBox()
-	x0, y0 := util.Gps2webmerc(b.MinX, b.MaxY)
-	x1, y1 := util.Gps2webmerc(b.MaxX, b.MinY)
-	return geom.Bbox{x0, y0, x1, y1}
+	return lngLatBbox(p.srs, p.BBox())
 }
 
-func (pgz *shpPolygonZ) Polygon() geom.Multiline {
-	lines := make(geom.Multiline, len(pgz.Parts))
-	var length int32
-	factor := 1.0
-	if pgz.srs.IsLngLat() {
-		factor = d2r
-	}
-	for i, idx := range pgz.Parts {
-		ln := len(pgz.Parts)
-		if i+1 >= ln {
-			length = int32(len(pgz.Points)) - idx
-		} else {
-			length = pgz.Parts[i+1] - idx
-		}
+func (pgz *shpPolygonZ) Polygons() geom.MultiPolygon {
+	return geom.AssemblePolygons(partsOf(pgz.Parts, pgz.Points, pgz.srs))
+}
 
-		lines[i] = make(geom.Coordinates, length)
-		for j, point := range pgz.Points[idx : idx+length] {
-			lng, lat, _ := pgz.srs.Inverse(point.X * factor, point.Y * factor)
-			lines[i][j] = geom.Point{lng, lat}
-		}
-	}
-	return lines
+func (pgz *shpPolygonZ) ZM() []geom.ZM {
+	return zmOf(pgz.Parts, len(pgz.Points), pgz.ZArray, pgz.MArray)
 }
 
 type shpPolyLineM struct {
@@ -130,38 +89,49 @@ type shpPolyLineM struct {
 }
 
 func (p *shpPolyLineM) Attribute(s string) string {
-	return p.attrs[s]
+	return zmAttribute(p, p.attrs, s)
+}
+
+func (p *shpPolyLineM) Attributes() map[string]string {
+	return p.attrs
 }
 
 func (p *shpPolyLineM) Bbox() geom.Bbox {
-	b := p.BBox()
-	x0, y0 := util.Gps2webmerc(b.MinX, b.MaxY)
-	x1, y1 := util.Gps2webmerc(b.MaxX, b.MinY)
-	return geom.Bbox{x0, y0, x1, y1}
+	return lngLatBbox(p.srs, p.BBox())
 }
 
 func (pgz *shpPolyLineM) Paths() geom.Multiline {
-	lines := make(geom.Multiline, len(pgz.Parts))
-	var length int32
-	factor := 1.0
-	if pgz.srs.IsLngLat() {
-		factor = d2r
-	}
-	for i, idx := range pgz.Parts {
-		ln := len(pgz.Parts)
-		if i+1 >= ln {
-			length = int32(len(pgz.Points)) - idx
-		} else {
-			length = pgz.Parts[i+1] - idx
-		}
+	return partsOf(pgz.Parts, pgz.Points, pgz.srs)
+}
 
-		lines[i] = make(geom.Coordinates, length)
-		for j, point := range pgz.Points[idx : idx+length] {
-			lng, lat, _ := pgz.srs.Inverse(point.X * factor, point.Y * factor)
-			lines[i][j] = geom.Point{lng, lat}
-		}
-	}
-	return lines
+func (pgz *shpPolyLineM) ZM() []geom.ZM {
+	return zmOf(pgz.Parts, len(pgz.Points), nil, pgz.MArray)
+}
+
+type shpPolyLineZ struct {
+	*shp.PolyLineZ
+	srs   projectron.Projection
+	attrs map[string]string
+}
+
+func (p *shpPolyLineZ) Attribute(s string) string {
+	return zmAttribute(p, p.attrs, s)
+}
+
+func (p *shpPolyLineZ) Attributes() map[string]string {
+	return p.attrs
+}
+
+func (p *shpPolyLineZ) Bbox() geom.Bbox {
+	return lngLatBbox(p.srs, p.BBox())
+}
+
+func (p *shpPolyLineZ) Paths() geom.Multiline {
+	return partsOf(p.Parts, p.Points, p.srs)
+}
+
+func (p *shpPolyLineZ) ZM() []geom.ZM {
+	return zmOf(p.Parts, len(p.Points), p.ZArray, p.MArray)
 }
 
 type shpPolyLine struct {
@@ -174,39 +144,104 @@ func (p *shpPolyLine) Attribute(s string) string {
 	return p.attrs[s]
 }
 
+func (p *shpPolyLine) Attributes() map[string]string {
+	return p.attrs
+}
+
 func (p *shpPolyLine) Bbox() geom.Bbox {
-	b := p.BBox()
-	x0, y0 := util.Gps2webmerc(b.MinX, b.MaxY)
-	x1, y1 := util.Gps2webmerc(b.MaxX, b.MinY)
-	return geom.Bbox{x0, y0, x1, y1}
+	return lngLatBbox(p.srs, p.BBox())
 }
 
 func (pgz *shpPolyLine) Paths() geom.Multiline {
-	lines := make(geom.Multiline, len(pgz.Parts))
-	var length int32
+	return partsOf(pgz.Parts, pgz.Points, pgz.srs)
+}
+
+// toLngLat moves a point out of the source projection.
+func toLngLat(srs projectron.Projection, x, y float64) geom.Point {
 	factor := 1.0
-	if pgz.srs.IsLngLat() {
+	if srs.IsLngLat() {
 		factor = d2r
 	}
-	for i, idx := range pgz.Parts {
-		ln := len(pgz.Parts)
-		if i+1 >= ln {
-			length = int32(len(pgz.Points)) - idx
-		} else {
-			length = pgz.Parts[i+1] - idx
-		}
+	lng, lat, _ := srs.Inverse(x*factor, y*factor)
+	return geom.Point{lng, lat}
+}
 
-		lines[i] = make(geom.Coordinates, length)
-		for j, point := range pgz.Points[idx : idx+length] {
-			lng, lat, _ := pgz.srs.Inverse(point.X * factor, point.Y * factor)
-			lines[i][j] = geom.Point{lng, lat}
+// lngLatBbox moves a shapefile bounding box out of the source
+// projection.  Every corner is moved, since the box may be skewed.
+func lngLatBbox(srs projectron.Projection, b shp.Box) geom.Bbox {
+	bb := geom.EmptyBbox()
+	for _, corner := range [4][2]float64{
+		{b.MinX, b.MinY}, {b.MaxX, b.MinY}, {b.MaxX, b.MaxY}, {b.MinX, b.MaxY},
+	} {
+		bb = bb.Union(toLngLat(srs, corner[0], corner[1]).Bbox())
+	}
+	return bb
+}
+
+// partsOf splits a shapefile point list into its parts and moves each
+// point out of the source projection.
+func partsOf(parts []int32, points []shp.Point, srs projectron.Projection) geom.Multiline {
+	lines := make(geom.Multiline, 0, len(parts))
+	for i, idx := range parts {
+		end := int32(len(points))
+		if i+1 < len(parts) {
+			end = parts[i+1]
+		}
+		if end <= idx {
+			continue
 		}
+		line := make(geom.Coordinates, end-idx)
+		for j, point := range points[idx:end] {
+			line[j] = toLngLat(srs, point.X, point.Y)
+		}
+		lines = append(lines, line)
 	}
 	return lines
 }
 
+// zmOf splits the Z and M values of a shapefile into the same parts
+// as partsOf does.  Measures below -1e38 mean there is none.
+func zmOf(parts []int32, n int, z, m []float64) []geom.ZM {
+	split := func(values []float64, idx, end int32) []float64 {
+		if int(end) > len(values) {
+			return nil
+		}
+		part := make([]float64, end-idx)
+		for i, v := range values[idx:end] {
+			if v < -1e38 {
+				v = math.NaN()
+			}
+			part[i] = v
+		}
+		return part
+	}
+	zms := make([]geom.ZM, 0, len(parts))
+	for i, idx := range parts {
+		end := int32(n)
+		if i+1 < len(parts) {
+			end = parts[i+1]
+		}
+		if end <= idx {
+			continue
+		}
+		zms = append(zms, geom.ZM{Z: split(z, idx, end), M: split(m, idx, end)})
+	}
+	return zms
+}
+
+// zmAttribute looks an attribute up, and falls back to the Z and M
+// values of the shape.
+func zmAttribute(shape geom.Shape, attrs map[string]string, name string) string {
+	if v, ok := attrs[name]; ok {
+		return v
+	}
+	v, _ := geom.ZMAttribute(shape, name)
+	return v
+}
+
 type shpPoint struct {
 	x, y  float64
+	srs   projectron.Projection
 	attrs map[string]string
 }
 
@@ -214,36 +249,74 @@ func (p *shpPoint) Attribute(s string) string {
 	return p.attrs[s]
 }
 
+func (p *shpPoint) Attributes() map[string]string {
+	return p.attrs
+}
+
 func (p *shpPoint) Bbox() geom.Bbox {
-	x, y := util.Gps2webmerc(p.x, p.y)
-	return geom.Bbox{x, y, x, y}
+	return p.Point().Bbox()
 }
 
 func (p *shpPoint) Point() geom.Point {
-	lng, lat := util.Gps2webmerc(p.x, p.y)
-	return geom.Point{lng, lat}
+	return toLngLat(p.srs, p.x, p.y)
+}
+
+// shpPointZ is a point with an elevation and a measure.
+type shpPointZ struct {
+	shpPoint
+	z, m float64
+}
+
+func (p *shpPointZ) Attribute(s string) string {
+	return zmAttribute(p, p.attrs, s)
+}
+
+func (p *shpPointZ) ZM() []geom.ZM {
+	m := p.m
+	if m < -1e38 {
+		m = math.NaN()
+	}
+	return []geom.ZM{{Z: []float64{p.z}, M: []float64{m}}}
+}
+
+type shpMultiPoint struct {
+	*shp.MultiPoint
+	srs   projectron.Projection
+	attrs map[string]string
+}
+
+func (p *shpMultiPoint) Attribute(s string) string {
+	return p.attrs[s]
+}
+
+func (p *shpMultiPoint) Attributes() map[string]string {
+	return p.attrs
+}
+
+func (p *shpMultiPoint) Bbox() geom.Bbox {
+	return lngLatBbox(p.srs, p.BBox())
+}
+
+func (p *shpMultiPoint) Points() geom.MultiPoint {
+	points := make(geom.MultiPoint, len(p.MultiPoint.Points))
+	for i, point := range p.MultiPoint.Points {
+		points[i] = toLngLat(p.srs, point.X, point.Y)
+	}
+	return points
 }
 
 func (s *shpSource) searchFor(q *query.Query, ch chan geom.Shape) {
 	defer close(ch)
 	defer s.r.Close()
 
-	factor := 1.0
-	if s.srs.IsLngLat() {
-		factor = d2r
-	}
-	b := s.r.BBox()
-	x0, y0, _ := s.srs.Inverse(b.MinX * factor, b.MaxY * factor)
-	x1, y1, _ := s.srs.Inverse(b.MaxX * factor, b.MinY * factor)
-	b3 := geom.Bbox{x0, y0, x1, y1}
-	fmt.Println("b3: ", b3)
-
-	fmt.Println("qb: ", q.Bounds)
-	if !b3.Overlaps(q.Bounds) {
+	b3 := lngLatBbox(s.srs, s.r.BBox())
+	if !b3.Intersects(q.Bounds) {
 		return
 	}
 
+	bounds := q.Bounds.Polygon()
 	fields := make([]string, len(s.r.Fields()))
+	columns := make(map[string]bool)
 
 	var fieldsToGrab []int
 	if q.Sel != nil {
@@ -251,49 +324,92 @@ func (s *shpSource) searchFor(q *query.Query, ch chan geom.Shape) {
 		for i, field := range s.r.Fields() {
 			f = strings.Trim(field.String(), " \x00")
 			fields[i] = f
-			for _, name := range q.Sel.Fields {
-				if name == f {
-					fieldsToGrab = append(fieldsToGrab, i)
-					fmt.Println(f)
-				}
+			columns[f] = true
+			if q.Sel.Has(f) {
+				fieldsToGrab = append(fieldsToGrab, i)
 			}
 		}
 	}
 
-	for s.r.Next() {
-		n, p := s.r.Shape()
-		b := p.BBox()
-		x0, y0, _ = s.srs.Inverse(b.MinX * factor, b.MaxY * factor)
-		x1, y1, _ = s.srs.Inverse(b.MaxX * factor, b.MinY * factor)
-		b3 = geom.Bbox{x0, y0, x1, y1}
-
-		if b3.Overlaps(q.Bounds) {
-			attrs := make(map[string]string)
-			if q.Sel != nil {
-				for _, i := range fieldsToGrab {
-					if val := s.r.ReadAttribute(n, i); val != "" {
-						attrs[fields[i]] = val
-					}
-				}
-			}
-			switch underlying := p.(type) {
-			case *shp.Polygon:
-				ch <- &shpPolygon{underlying, s.srs, attrs}
-			case *shp.PolygonZ:
-				ch <- &shpPolygonZ{underlying, s.srs, attrs}
-			case *shp.PolyLine:
-				ch <- &shpPolyLine{underlying, s.srs, attrs}
-			case *shp.PolyLineM:
-				ch <- &shpPolyLineM{underlying, s.srs, attrs}
-			case *shp.Point:
-				ch <- &shpPoint{underlying.X, underlying.Y, attrs}
-			default:
-				fmt.Println(reflect.TypeOf(p).Elem())
+	// a query that only tests columns of the DBF is applied to the
+	// record before its shape is built; one that tests the geometry,
+	// or Z and M values, has to wait for it.  The reader decodes the
+	// geometry of every record in Next, and can't skip one, so what a
+	// record that fails saves is projecting and building its shape.
+	used, geometric := q.Uses()
+	early := !geometric
+	for _, f := range used {
+		early = early && columns[f]
+	}
+
+	sent := 0
+	for n := 0; s.r.Next(); n++ {
+		// every field selected is kept, even if it is empty, so that
+		// an empty value isn't taken for a missing one
+		attrs := make(map[string]string, len(fieldsToGrab))
+		for _, i := range fieldsToGrab {
+			attrs[fields[i]] = strings.TrimRight(s.r.ReadAttribute(n, i), "\x00")
+		}
+		if early && !q.Matches(shpRecord(attrs)) {
+			continue
+		}
+		_, p := s.r.Shape()
+		box := lngLatBbox(s.srs, p.BBox())
+		if !box.Intersects(q.Bounds) {
+			continue
+		}
+		var shape geom.Shape
+		switch underlying := p.(type) {
+		case *shp.Polygon:
+			shape = &shpPolygon{underlying, s.srs, attrs}
+		case *shp.PolygonZ:
+			shape = &shpPolygonZ{underlying, s.srs, attrs}
+		case *shp.PolyLine:
+			shape = &shpPolyLine{underlying, s.srs, attrs}
+		case *shp.PolyLineZ:
+			shape = &shpPolyLineZ{underlying, s.srs, attrs}
+		case *shp.PolyLineM:
+			shape = &shpPolyLineM{underlying, s.srs, attrs}
+		case *shp.MultiPoint:
+			shape = &shpMultiPoint{underlying, s.srs, attrs}
+		case *shp.Point:
+			shape = &shpPoint{underlying.X, underlying.Y, s.srs, attrs}
+		case *shp.PointZ:
+			point := shpPoint{underlying.X, underlying.Y, s.srs, attrs}
+			shape = &shpPointZ{point, underlying.Z, underlying.M}
+		default:
+			continue
+		}
+		if !early && !q.Matches(shape) {
+			continue
+		}
+		// a shape inside the query's bounds meets them; one across
+		// their edge may still miss them, and only then is its
+		// geometry built to find out
+		if q.Bounds.Contains(box) || geom.Intersects(geom.GeometryOf(shape), bounds) {
+			ch <- shape
+			if sent++; sent == q.Limit {
+				return
 			}
 		}
 	}
 }
 
+// shpRecord is the attributes of a record, before its shape is read.
+type shpRecord map[string]string
+
+func (r shpRecord) Bbox() geom.Bbox {
+	return geom.EmptyBbox()
+}
+
+func (r shpRecord) Attribute(s string) string {
+	return r[s]
+}
+
+func (r shpRecord) Attributes() map[string]string {
+	return r
+}
+
 func createShpSource(name string) (DataSource, error) {
 	f, err := shp.Open(name)
 	if err != nil {
@@ -0,0 +1,141 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeShapefile writes points, at longitudes and latitudes in degrees,
+// and a DBF of text fields with a row for each.  Values are padded with
+// spaces, as they are in a DBF, so an empty one is all spaces.
+func writeShapefile(t *testing.T, points [][2]float64, fields []string, rows [][]string) string {
+	dir, err := ioutil.TempDir("", "shp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	le, be := binary.LittleEndian, binary.BigEndian
+
+	var shp bytes.Buffer
+	header := make([]byte, 100)
+	be.PutUint32(header[0:], 9994)
+	be.PutUint32(header[24:], uint32(50+14*len(points)))
+	le.PutUint32(header[28:], 1000)
+	le.PutUint32(header[32:], 1)
+	box := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		box = [4]float64{math.Min(box[0], p[0]), math.Min(box[1], p[1]), math.Max(box[2], p[0]), math.Max(box[3], p[1])}
+	}
+	for i, v := range box {
+		le.PutUint64(header[36+8*i:], math.Float64bits(v))
+	}
+	shp.Write(header)
+	for i, p := range points {
+		record := make([]byte, 28)
+		be.PutUint32(record[0:], uint32(i+1))
+		be.PutUint32(record[4:], 10)
+		le.PutUint32(record[8:], 1)
+		le.PutUint64(record[12:], math.Float64bits(p[0]))
+		le.PutUint64(record[20:], math.Float64bits(p[1]))
+		shp.Write(record)
+	}
+
+	const size = 10
+	var dbf bytes.Buffer
+	header = make([]byte, 32)
+	header[0] = 3
+	le.PutUint32(header[4:], uint32(len(rows)))
+	le.PutUint16(header[8:], uint16(33+32*len(fields)))
+	le.PutUint16(header[10:], uint16(1+size*len(fields)))
+	dbf.Write(header)
+	for _, name := range fields {
+		field := make([]byte, 32)
+		copy(field, name)
+		field[11] = 'C'
+		field[16] = size
+		dbf.Write(field)
+	}
+	dbf.WriteByte('\r')
+	for _, row := range rows {
+		dbf.WriteByte(' ')
+		for _, v := range row {
+			dbf.Write(append([]byte(v), bytes.Repeat([]byte(" "), size-len(v))...))
+		}
+	}
+
+	name := filepath.Join(dir, "test.shp")
+	if err := ioutil.WriteFile(name, shp.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.dbf"), dbf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// queryShapefile runs a filter over the test points, and returns the
+// names of the shapes that come back.
+func queryShapefile(t *testing.T, filter string, limit int) []string {
+	name := writeShapefile(t,
+		[][2]float64{{1, 1}, {2, 2}, {3, 3}, {50, 50}},
+		[]string{"name", "ref"},
+		[][]string{{"a", "A1"}, {"b", ""}, {"c", "C3"}, {"d", "A4"}})
+	defer os.RemoveAll(filepath.Dir(name))
+	ds, err := Open("file", "shp", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	f, err := query.Compile(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2r := math.Pi / 180
+	q := query.NewQuery(geom.NewBbox(0, 0, 10*d2r, 10*d2r)).Where(f).Include("name")
+	q.Limit = limit
+	var names []string
+	for shape := range ds.Query(q) {
+		names = append(names, shape.Attribute("name"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestShpSourceFilters(t *testing.T) {
+	tests := []struct {
+		filter, want string
+	}{
+		{"", "[a b c]"},
+		// applied to the records before their shapes are built
+		{"ref ~ '^A'", "[a]"},
+		{"name in (b, c, d)", "[b c]"},
+		// applied to the shapes
+		{"geometry_type = point and name != c", "[a b]"},
+		{"intersects(bbox(1.5, 1.5, 10, 10)) and ref", "[c]"},
+		// b has an empty ref, which isn't a missing one
+		{"ref is null", "[]"},
+		{"ref is not null and ref = ''", "[b]"},
+		{"missing is null and not name in (a, c)", "[b]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(queryShapefile(t, test.filter, 0)); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.filter, test.want, got)
+		}
+	}
+	if got := fmt.Sprint(queryShapefile(t, "name != a", 1)); got != "[b]" {
+		t.Errorf("expected the source to stop at the limit, got %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"log"
+)
+
+type validatingSource struct {
+	DataSource
+}
+
+// Validating checks every shape that ds finds.  Invalid shapes are
+// logged and repaired with geom.MakeValid, and dropped if nothing is
+// left of them.
+func Validating(ds DataSource) DataSource {
+	return &validatingSource{ds}
+}
+
+func (s *validatingSource) Query(q *query.Query) chan geom.Shape {
+	in := s.DataSource.Query(q)
+	ch := make(chan geom.Shape, 1000)
+	go func() {
+		defer close(ch)
+		for shape := range in {
+			if shape = validate(shape); shape != nil {
+				ch <- shape
+			}
+		}
+	}()
+	return ch
+}
+
+// validate returns the shape if it is valid, a repaired copy of it if
+// it isn't, or nil if it can't be repaired.
+func validate(shape geom.Shape) geom.Shape {
+	g := geom.GeometryOf(shape)
+	err := geom.Validate(g)
+	if err == nil {
+		return shape
+	}
+	fixed := reshape(shape, geom.MakeValid(g))
+	if fixed == nil {
+		log.Printf("dropping a shape in %v: %v", shape.Bbox(), err)
+	} else {
+		log.Printf("repairing a shape in %v: %v", shape.Bbox(), err)
+	}
+	return fixed
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sources
+
+import (
+	"github.com/samlecuyer/ecumene/geom"
+	"github.com/samlecuyer/ecumene/query"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+)
+
+type polygonShape struct {
+	name     string
+	polygons geom.MultiPolygon
+}
+
+func (s *polygonShape) Bbox() geom.Bbox               { return s.polygons.Bbox() }
+func (s *polygonShape) Polygons() geom.MultiPolygon   { return s.polygons }
+func (s *polygonShape) Attribute(name string) string  { return s.name }
+func (s *polygonShape) Attributes() map[string]string { return map[string]string{"name": s.name} }
+
+func TestValidating(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	square := geom.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}}
+	bowtie := geom.Polygon{{{0, 0}, {4, 4}, {4, 0}, {0, 4}, {0, 0}}}
+	flat := geom.Polygon{{{0, 0}, {2, 0}, {4, 0}, {0, 0}}}
+	ds := Validating(NewMemorySource([]geom.Shape{
+		&polygonShape{"square", geom.MultiPolygon{square}},
+		&polygonShape{"bowtie", geom.MultiPolygon{bowtie}},
+		&polygonShape{"flat", geom.MultiPolygon{flat}},
+	}))
+	defer ds.Close()
+
+	found := make(map[string]geom.Shape)
+	for shape := range ds.Query(query.NewQuery(geom.NewBbox(-1, -1, 5, 5))) {
+		found[shape.Attribute("name")] = shape
+	}
+	if len(found) != 2 || found["square"] == nil || found["bowtie"] == nil {
+		t.Fatalf("expected the square and the repaired bow tie, got %v", found)
+	}
+	if _, ok := found["square"].(*polygonShape); !ok {
+		t.Error("expected the valid square to be passed on as it is")
+	}
+	bowtieShape, ok := found["bowtie"].(geom.PolygonShape)
+	if !ok {
+		t.Fatalf("expected the bow tie to still be a polygon, got %T", found["bowtie"])
+	}
+	if err := geom.Validate(bowtieShape.Polygons()); err != nil || len(bowtieShape.Polygons()) != 2 {
+		t.Errorf("expected the bow tie to be repaired into two triangles, got %v", bowtieShape.Polygons())
+	}
+	if attrs := found["bowtie"].(geom.AttributedShape).Attributes(); attrs["name"] != "bowtie" {
+		t.Errorf("expected the repaired shape to keep its attributes, got %v", attrs)
+	}
+}
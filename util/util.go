@@ -28,6 +28,13 @@ func Deg2num(lng, lat float64, zoom int) (x, y int) {
 	return
 }
 
+// WrapX moves a tile column into [0, 2^zoom), so that a tile off either
+// side of the world shows the copy of the world next to it.
+func WrapX(x, zoom int) int {
+	n := 1 << uint(zoom)
+	return ((x % n) + n) % n
+}
+
 type SymbolizerType uint
 
 const (
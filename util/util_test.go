@@ -0,0 +1,31 @@
+// Copyright 2015 Sam L'ecuyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestWrapX(t *testing.T) {
+	tests := []struct {
+		x, zoom, want int
+	}{
+		{0, 0, 0},
+		{1, 0, 0},
+		{-1, 0, 0},
+		{3, 2, 3},
+		{4, 2, 0},
+		{9, 2, 1},
+		{-1, 2, 3},
+		{-4, 2, 0},
+		{-9, 2, 3},
+		{1 << 20, 20, 0},
+	}
+	for _, test := range tests {
+		if got := WrapX(test.x, test.zoom); got != test.want {
+			t.Errorf("WrapX(%d, %d): expected %d, got %d", test.x, test.zoom, test.want, got)
+		}
+	}
+}